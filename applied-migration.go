@@ -1,7 +1,10 @@
 package schema
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/user"
 	"time"
 )
 
@@ -11,7 +14,9 @@ import (
 type AppliedMigration struct {
 	Migration
 
-	// Checksum is the MD5 hash of the Script for this migration
+	// Checksum is the checksum of the Script for this migration, in the
+	// format described by ChecksumAlgorithm. It is the MD5 hash of the Script
+	// unless another ChecksumAlgorithm was configured.
 	Checksum string
 
 	// ExecutionTimeInMillis is populated after the migration is run, indicating
@@ -21,6 +26,46 @@ type AppliedMigration struct {
 	// AppliedAt is the time at which this particular migration's Script began
 	// executing (not when it completed executing).
 	AppliedAt time.Time
+
+	// AppliedBy is the operating system user which applied the migration.
+	// It, Hostname, AppVersion and the embedded Migration's Script are only
+	// recorded with WithExtendedTracking.
+	AppliedBy string
+
+	// Hostname is the host which applied the migration
+	Hostname string
+
+	// AppVersion is the application version supplied to WithAppVersion
+	AppVersion string
+
+	// Baselined is true when the migration was marked as applied by Baseline
+	// or Import without its Script being run by this package. Its
+	// ExecutionTimeInMillis is then 0, though the tracking table records -1
+	// (see TrackingTableVersion).
+	Baselined bool
+}
+
+// checksum returns the checksum to record for the migration, defaulting to
+// the MD5 hash of its Script when no Checksum was supplied
+func (am *AppliedMigration) checksum() string {
+	if am.Checksum != "" {
+		return am.Checksum
+	}
+	return am.MD5()
+}
+
+// localUsername identifies the operating system user in extended tracking
+// records
+var localUsername = currentUsername()
+
+func currentUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
 }
 
 // GetAppliedMigrations retrieves all already-applied migrations in a map keyed
@@ -29,7 +74,17 @@ func (m Migrator) GetAppliedMigrations(db Queryer) (applied map[string]*AppliedM
 	applied = make(map[string]*AppliedMigration)
 
 	// Get the raw data from the Dialect
-	migrations, err := m.Dialect.GetAppliedMigrations(m.ctx, db, m.QuotedTableName())
+	var migrations []*AppliedMigration
+	if m.extendedTracking {
+		var tracker ExtendedTracker
+		tracker, err = m.extendedTracker()
+		if err != nil {
+			return applied, err
+		}
+		migrations, err = tracker.GetExtendedAppliedMigrations(m.ctx, db, m.QuotedTableName())
+	} else {
+		migrations, err = m.Dialect.GetAppliedMigrations(m.ctx, db, m.QuotedTableName())
+	}
 	if err != nil {
 		err = fmt.Errorf("Failed to GetAppliedMigrations. Did somebody change the structure of the %s table? %w", m.QuotedTableName(), err)
 		return applied, err
@@ -37,8 +92,60 @@ func (m Migrator) GetAppliedMigrations(db Queryer) (applied map[string]*AppliedM
 
 	// Re-index into a map
 	for _, migration := range migrations {
+		if migration.ExecutionTimeInMillis == baselineExecutionTime {
+			migration.ExecutionTimeInMillis = 0
+			migration.Baselined = true
+		}
 		applied[migration.ID] = migration
 	}
 
 	return applied, err
 }
+
+// createMigrationsTable creates the tracking table if it doesn't exist and
+// upgrades its structure if the Migrator's options need it. When
+// WithExtendedTracking is enabled, the extended columns are added unless the
+// table already has them.
+func (m Migrator) createMigrationsTable(tx Queryer) error {
+	err := m.Dialect.CreateMigrationsTable(m.ctx, tx, m.QuotedTableName())
+	if err != nil {
+		return err
+	}
+	err = m.upgradeMigrationsTable(tx)
+	if err != nil || !m.extendedTracking {
+		return err
+	}
+	tracker, err := m.extendedTracker()
+	if err != nil {
+		return err
+	}
+	return tracker.ExtendMigrationsTable(m.ctx, tx, m.QuotedTableName())
+}
+
+// insertAppliedMigration records a migration in the tracking table, including
+// the extended columns when WithExtendedTracking is enabled
+func (m Migrator) insertAppliedMigration(tx Queryer, am *AppliedMigration) error {
+	if am.Baselined {
+		baselined := *am
+		baselined.ExecutionTimeInMillis = baselineExecutionTime
+		am = &baselined
+	}
+	if !m.extendedTracking {
+		return m.Dialect.InsertAppliedMigration(m.ctx, tx, m.QuotedTableName(), am)
+	}
+	tracker, err := m.extendedTracker()
+	if err != nil {
+		return err
+	}
+	return tracker.InsertExtendedAppliedMigration(m.ctx, tx, m.QuotedTableName(), am)
+}
+
+// extendedTracker returns the Dialect as an ExtendedTracker, or an error if
+// it doesn't support extended tracking
+func (m Migrator) extendedTracker() (ExtendedTracker, error) {
+	tracker, isTracker := m.Dialect.(ExtendedTracker)
+	if !isTracker {
+		return nil, fmt.Errorf("%T doesn't support WithExtendedTracking: %w", m.Dialect, errors.ErrUnsupported)
+	}
+	return tracker, nil
+}
@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"errors"
 	"testing"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
@@ -64,3 +65,70 @@ func TestGetAppliedMigrationsHasFriendlyScanError(t *testing.T) {
 		expectErrorContains(t, err, migrator.TableName)
 	})
 }
+
+func TestExtendedTracking(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrations := testMigrations(t, "useless-ansi")
+
+		// The first migration is applied before extended tracking is enabled,
+		// so that the existing tracking table has to be extended
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		err := migrator.Apply(db, migrations[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		extended := NewMigrator(WithDialect(tdb.Dialect), WithTableName(migrator.TableName), WithAppVersion("abc123"))
+		err = extended.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Extending the table again is harmless
+		err = extended.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		applied, err := extended.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != len(migrations) {
+			t.Fatalf("Expected %d applied migrations. Got %d", len(migrations), len(applied))
+		}
+		first := applied[migrations[0].ID]
+		if first.AppliedBy != "" || first.AppVersion != "" || first.Script != "" {
+			t.Errorf("Expected no extended tracking for the first migration. Got %+v", first)
+		}
+		for _, migration := range migrations[1:] {
+			am := applied[migration.ID]
+			if am.AppliedBy != localUsername || am.Hostname != localHostname || am.AppVersion != "abc123" {
+				t.Errorf("Unexpected extended tracking for '%s': %q, %q, %q", am.ID, am.AppliedBy, am.Hostname, am.AppVersion)
+			}
+			if am.Script != migration.Script {
+				t.Errorf("Expected the Script of '%s' to be tracked. Got %q", am.ID, am.Script)
+			}
+		}
+
+		// The extended columns don't get in the way of ordinary tracking
+		_, err = migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestExtendedTrackingUnsupported(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(&flakyLockDialect{Dialect: SQLite}), WithExtendedTracking())
+		err := migrator.Apply(db, testMigrations(t, "useless-ansi"))
+		if !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("Expected errors.ErrUnsupported. Got %v", err)
+		}
+	})
+}
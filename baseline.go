@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"fmt"
+	"time"
+)
+
+// baselineExecutionTime is stored in the execution_time_in_millis column of
+// the tracking table to mark an AppliedMigration as Baselined, since no
+// migration which actually ran can take a negative time. The Migrator
+// translates it to and from the Baselined field.
+const baselineExecutionTime = -1
+
+// Baseline marks every supplied Migration whose ID sorts at or before upToID
+// as applied, without executing its Script. It is intended for adopting this
+// package on an existing database whose schema already matches those
+// migrations. Tracking rows are recorded with the checksums of the current
+// Scripts, and are reported as Baselined by GetAppliedMigrations.
+// Migrations which are already applied are left alone. Baseline holds the
+// Migrator's lock, and records every row in a single transaction.
+func (m *Migrator) Baseline(db DB, migrations []*Migration, upToID string) error {
+	if db == nil {
+		return ErrNilDB
+	}
+	if !containsID(migrations, upToID) {
+		return fmt.Errorf("can't baseline up to '%s': it is not among the supplied migrations", upToID)
+	}
+
+	return m.inLockedTx(db, func(tx Queryer) error {
+		applied, err := m.GetAppliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+
+		baseline := make([]*Migration, 0)
+		for _, migration := range migrations {
+			if _, isApplied := applied[migration.ID]; !isApplied && migration.ID <= upToID {
+				baseline = append(baseline, migration)
+			}
+		}
+		SortMigrations(baseline)
+
+		now := time.Now()
+		for _, migration := range baseline {
+			err = m.insertUnexecutedMigration(tx, migration, now)
+			if err != nil {
+				return err
+			}
+			m.log(fmt.Sprintf("Baselined '%s' without running it", migration.ID))
+		}
+		return nil
+	})
+}
+
+// insertUnexecutedMigration records a migration as applied at the supplied
+// time without executing its Script
+func (m *Migrator) insertUnexecutedMigration(tx Queryer, migration *Migration, appliedAt time.Time) error {
+	am := AppliedMigration{}
+	am.ID = migration.ID
+	am.Script = migration.Script
+	am.Checksum = m.checksum(migration)
+	am.Baselined = true
+	am.AppliedAt = appliedAt
+	am.AppliedBy = localUsername
+	am.Hostname = localHostname
+	am.AppVersion = m.appVersion
+	return m.insertAppliedMigration(tx, &am)
+}
+
+// containsID reports whether one of the supplied migrations has the ID
+func containsID(migrations []*Migration, id string) bool {
+	for _, migration := range migrations {
+		if migration.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		// The baselined Scripts would fail if they were executed
+		migrations := []*Migration{
+			{ID: "2021-01-02 Already There", Script: "THIS IS NOT SQL"},
+			{ID: "2021-01-01 Also There", Script: "NOR IS THIS"},
+			{ID: "2021-01-03 New", Script: "SELECT 1;"},
+		}
+
+		var lines LogLines
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithLogger(&lines))
+		err := migrator.Baseline(db, migrations, "2021-01-02 Already There")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !lines.Contains("Baselined '2021-01-01 Also There'") {
+			t.Errorf("Expected the baseline to be logged. Got %v", lines)
+		}
+
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != 2 {
+			t.Fatalf("Expected 2 baselined migrations. Got %d", len(applied))
+		}
+		for _, migration := range migrations[:2] {
+			am := applied[migration.ID]
+			if am == nil || !am.Baselined || am.Checksum != migration.MD5() || am.ExecutionTimeInMillis != 0 {
+				t.Errorf("Expected '%s' to be baselined with its checksum. Got %+v", migration.ID, am)
+			}
+		}
+
+		// Baselining again is harmless, and only the new migration is run
+		err = migrator.Baseline(db, migrations, "2021-01-02 Already There")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		applied, err = migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != 3 || applied["2021-01-03 New"].Baselined {
+			t.Errorf("Expected the new migration to be applied normally. Got %+v", applied["2021-01-03 New"])
+		}
+		_, err = migrator.Validate(db, migrations)
+		if err != nil {
+			t.Errorf("Expected the baseline to validate. Got %v", err)
+		}
+
+		err = migrator.Baseline(db, migrations, "2099-01-01 Nonexistent")
+		expectErrorContains(t, err, "not among the supplied migrations")
+	})
+}
@@ -0,0 +1,224 @@
+package schema
+
+import (
+	"context"
+	"crypto/md5" // #nosec MD5 only being used to fingerprint script contents, not for encryption
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ChecksumAlgorithm fingerprints migration Scripts, so that changes to
+// already-applied migrations can be detected. See WithChecksumAlgorithm.
+type ChecksumAlgorithm interface {
+	// Name identifies the algorithm. Checksums are recorded with the name as
+	// a prefix, as in "sha256:<hex>", except for those of MD5Checksum, which
+	// are recorded without a prefix for compatibility with older releases.
+	Name() string
+
+	// Sum returns the checksum of the supplied Script, without the prefix
+	Sum(script string) string
+}
+
+var (
+	// MD5Checksum is the default ChecksumAlgorithm
+	MD5Checksum ChecksumAlgorithm = md5Checksum{}
+
+	// SHA256Checksum is a ChecksumAlgorithm which uses SHA-256
+	SHA256Checksum ChecksumAlgorithm = sha256Checksum{}
+)
+
+// normalizedPrefix is prepended to the name of a ChecksumAlgorithm wrapped by
+// NormalizedChecksum
+const normalizedPrefix = "normalized-"
+
+// normalizationLexicalRules are used to find the comments in a Script when
+// the Dialect's lexical rules are unknown, as when a NormalizedChecksum is
+// used outside of a Migrator. They cover the syntax common to the supported
+// databases.
+var normalizationLexicalRules = lexicalRules{dollarQuotes: true}
+
+// NormalizedChecksum wraps a ChecksumAlgorithm so that it checksums a
+// normalized form of each Script, in which line endings are unified, SQL
+// comments are removed, the whitespace between the tokens of each line is
+// reduced to the single spaces which keep them apart, trailing whitespace is
+// stripped from each line (even inside multi-line strings) and blank lines
+// are dropped. Indentation and the contents of strings are kept. Comments
+// are found with the lexical rules of the Migrator's Dialect, so that strings
+// and comments are told apart as the database would. Cosmetic edits to
+// applied migrations therefore pass validation, while any other change to a
+// Script is still detected. Its checksums are recorded with a "normalized-"
+// prefix on the wrapped algorithm's name, as in "normalized-sha256:<hex>".
+func NormalizedChecksum(algorithm ChecksumAlgorithm) ChecksumAlgorithm {
+	return normalizedChecksum{algorithm: algorithm, rules: normalizationLexicalRules}
+}
+
+type normalizedChecksum struct {
+	algorithm ChecksumAlgorithm
+	rules     lexicalRules
+}
+
+func (n normalizedChecksum) Name() string { return normalizedPrefix + n.algorithm.Name() }
+
+func (n normalizedChecksum) Sum(script string) string {
+	return n.algorithm.Sum(normalizeScript(script, n.rules))
+}
+
+// normalizeScript produces the form of script checksummed by
+// NormalizedChecksum, finding comments with the supplied lexical rules
+func normalizeScript(script string, rules lexicalRules) string {
+	script = strings.ReplaceAll(script, "\r\n", "\n")
+	script = strings.ReplaceAll(script, "\r", "\n")
+	script = minifyScript(script, rules)
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// builtinChecksumAlgorithms are recognized in the tracking table regardless
+// of the ChecksumAlgorithm the Migrator is configured with
+var builtinChecksumAlgorithms = []ChecksumAlgorithm{MD5Checksum, SHA256Checksum}
+
+type md5Checksum struct{}
+
+func (md5Checksum) Name() string { return "md5" }
+
+func (md5Checksum) Sum(script string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(script))) // #nosec not being used cryptographically
+}
+
+type sha256Checksum struct{}
+
+func (sha256Checksum) Name() string { return "sha256" }
+
+func (sha256Checksum) Sum(script string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(script)))
+}
+
+// ChecksumUpdater defines an optional Dialect extension for replacing the
+// checksum recorded for an applied migration. It is used to rewrite
+// checksums in the configured algorithm (see WithChecksumRewrite).
+type ChecksumUpdater interface {
+	UpdateChecksum(ctx context.Context, tx Queryer, tableName, id, checksum string) error
+}
+
+// formatChecksum computes the checksum of script with the supplied
+// algorithm, in the format it is recorded in the tracking table
+func formatChecksum(algorithm ChecksumAlgorithm, script string) string {
+	if algorithm.Name() == MD5Checksum.Name() {
+		return algorithm.Sum(script)
+	}
+	return algorithm.Name() + ":" + algorithm.Sum(script)
+}
+
+// checksumAlgorithmName returns the name of the algorithm which produced a
+// recorded checksum
+func checksumAlgorithmName(checksum string) string {
+	name, _, prefixed := strings.Cut(checksum, ":")
+	if !prefixed {
+		return MD5Checksum.Name()
+	}
+	return name
+}
+
+// checksumAlgorithm returns the ChecksumAlgorithm configured with
+// WithChecksumAlgorithm, defaulting to MD5Checksum
+func (m Migrator) checksumAlgorithm() ChecksumAlgorithm {
+	if m.checksummer == nil {
+		return MD5Checksum
+	}
+	return m.forDialect(m.checksummer)
+}
+
+// forDialect makes a NormalizedChecksum find comments with the lexical rules
+// of the Migrator's Dialect. Other algorithms are returned unchanged.
+func (m Migrator) forDialect(algorithm ChecksumAlgorithm) ChecksumAlgorithm {
+	normalized, isNormalized := algorithm.(normalizedChecksum)
+	if !isNormalized {
+		return algorithm
+	}
+	if lexer, isLexer := m.Dialect.(scriptLexer); isLexer {
+		normalized.rules = lexer.scriptRules()
+	}
+	return normalized
+}
+
+// checksum computes the checksum to record for a newly-applied migration
+func (m Migrator) checksum(migration *Migration) string {
+	return formatChecksum(m.checksumAlgorithm(), migration.Script)
+}
+
+// checksumLike computes the checksum of the supplied migration with the
+// algorithm which produced the recorded checksum, so that the two can be
+// compared. The configured algorithm is used when the recorded one is
+// unknown.
+func (m Migrator) checksumLike(migration *Migration, recorded string) string {
+	algorithm := m.checksumAlgorithmNamed(checksumAlgorithmName(recorded))
+	if algorithm == nil {
+		return m.checksum(migration)
+	}
+	return formatChecksum(algorithm, migration.Script)
+}
+
+// checksumAlgorithmNamed finds the configured or built-in ChecksumAlgorithm
+// with the supplied name, including normalized variants of the built-in
+// algorithms. It returns nil if there is none.
+func (m Migrator) checksumAlgorithmNamed(name string) ChecksumAlgorithm {
+	for _, algorithm := range append([]ChecksumAlgorithm{m.checksumAlgorithm()}, builtinChecksumAlgorithms...) {
+		if algorithm.Name() == name {
+			return algorithm
+		}
+	}
+	if base, normalized := strings.CutPrefix(name, normalizedPrefix); normalized {
+		if algorithm := m.checksumAlgorithmNamed(base); algorithm != nil {
+			return m.forDialect(NormalizedChecksum(algorithm))
+		}
+	}
+	return nil
+}
+
+// checksumMatches reports whether the Script of the supplied migration is
+// unchanged since it was applied. The recorded checksum may have been
+// produced by any known ChecksumAlgorithm.
+func (m Migrator) checksumMatches(migration *Migration, applied *AppliedMigration) bool {
+	return m.checksumLike(migration, applied.Checksum) == applied.Checksum
+}
+
+// rewriteChecksums replaces the recorded checksums of unchanged, applied
+// migrations which were produced by an algorithm other than the configured
+// one, when WithChecksumRewrite is enabled
+func (m Migrator) rewriteChecksums(tx Queryer, migrations []*Migration) error {
+	if !m.checksumRewrite {
+		return nil
+	}
+	updater, isUpdater := m.Dialect.(ChecksumUpdater)
+	if !isUpdater {
+		return fmt.Errorf("%T doesn't support WithChecksumRewrite: %w", m.Dialect, errors.ErrUnsupported)
+	}
+
+	applied, err := m.GetAppliedMigrations(tx)
+	if err != nil {
+		return err
+	}
+	name := m.checksumAlgorithm().Name()
+	for _, migration := range migrations {
+		am, exists := applied[migration.ID]
+		if !exists || checksumAlgorithmName(am.Checksum) == name || !m.checksumMatches(migration, am) {
+			continue
+		}
+		err = updater.UpdateChecksum(m.ctx, tx, m.QuotedTableName(), migration.ID, m.checksum(migration))
+		if err != nil {
+			return err
+		}
+		m.log(fmt.Sprintf("Rewrote the %s checksum of '%s' with %s", checksumAlgorithmName(am.Checksum), migration.ID, name))
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormatChecksum(t *testing.T) {
+	script := "SELECT 1;"
+	md5 := formatChecksum(MD5Checksum, script)
+	if md5 != (&Migration{Script: script}).MD5() {
+		t.Errorf("Expected MD5 checksums to be unprefixed. Got %s", md5)
+	}
+	sha := formatChecksum(SHA256Checksum, script)
+	if !strings.HasPrefix(sha, "sha256:") || len(sha) != 71 {
+		t.Errorf("Expected a prefixed SHA-256 checksum. Got %s", sha)
+	}
+
+	for checksum, expected := range map[string]string{md5: "md5", sha: "sha256", "custom:abc": "custom"} {
+		if actual := checksumAlgorithmName(checksum); actual != expected {
+			t.Errorf("Expected %s to be named %s. Got %s", checksum, expected, actual)
+		}
+	}
+}
+
+// TestSwitchingChecksumAlgorithms ensures that MD5 checksums recorded by
+// older releases are still verified after switching to SHA-256, and that
+// they can be rewritten
+func TestSwitchingChecksumAlgorithms(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrations := testMigrations(t, "useless-ansi")
+		md5Migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		err := md5Migrator.Apply(db, migrations[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var lines LogLines
+		shaMigrator := NewMigrator(WithDialect(tdb.Dialect), WithTableName(md5Migrator.TableName), WithChecksumAlgorithm(SHA256Checksum), WithLogger(&lines))
+		err = shaMigrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = shaMigrator.Validate(db, migrations)
+		if err != nil {
+			t.Errorf("Expected the MD5 checksum to be accepted. Got %v", err)
+		}
+		applied, err := shaMigrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checksumAlgorithmName(applied[migrations[0].ID].Checksum) != "md5" {
+			t.Errorf("Expected the first checksum to be left alone without WithChecksumRewrite")
+		}
+		for _, migration := range migrations[1:] {
+			if applied[migration.ID].Checksum != formatChecksum(SHA256Checksum, migration.Script) {
+				t.Errorf("Expected a SHA-256 checksum for '%s'. Got %s", migration.ID, applied[migration.ID].Checksum)
+			}
+		}
+
+		rewriter := NewMigrator(WithDialect(tdb.Dialect), WithTableName(md5Migrator.TableName), WithChecksumAlgorithm(SHA256Checksum), WithChecksumRewrite(), WithLogger(&lines))
+		err = rewriter.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !lines.Contains("Rewrote the md5 checksum of '" + migrations[0].ID + "' with sha256") {
+			t.Errorf("Expected the rewrite to be logged. Got %v", lines)
+		}
+		applied, err = rewriter.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied[migrations[0].ID].Checksum != formatChecksum(SHA256Checksum, migrations[0].Script) {
+			t.Errorf("Expected the MD5 checksum to be rewritten. Got %s", applied[migrations[0].ID].Checksum)
+		}
+
+		// An edited script is still detected, and reported in the recorded
+		// checksum's algorithm
+		edited := &Migration{ID: migrations[0].ID, Script: migrations[0].Script + "\nSELECT 2;"}
+		report, err := md5Migrator.Validate(db, []*Migration{edited})
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("Expected ErrChecksumMismatch. Got %v", err)
+		}
+		if !strings.HasPrefix(report.ChecksumMismatches[0].Actual, "sha256:") {
+			t.Errorf("Expected the actual checksum to use SHA-256. Got %s", report.ChecksumMismatches[0].Actual)
+		}
+	})
+}
+
+func TestNormalizedChecksum(t *testing.T) {
+	normalized := NormalizedChecksum(SHA256Checksum)
+	if normalized.Name() != "normalized-sha256" {
+		t.Errorf("Expected normalized-sha256. Got %s", normalized.Name())
+	}
+
+	original := "-- Create the users table\nCREATE TABLE users (\n  id INTEGER, /* the key */\n  name VARCHAR(255)\n);\n"
+	cosmetic := map[string]string{
+		"CRLF":               strings.ReplaceAll(original, "\n", "\r\n"),
+		"TrailingWhitespace": strings.ReplaceAll(original, "\n", " \t\n"),
+		"EditedComments":     "-- Creates users\n-- (reviewed)\nCREATE TABLE users (\n  id INTEGER, /* primary key */\n  name VARCHAR(255) -- display name\n);",
+		"BlankLines":         "\n\n" + strings.ReplaceAll(original, ",\n", ",\n\n"),
+		"InlineComments":     strings.Replace(strings.Replace(original, "id INTEGER", "id /* key */ INTEGER", 1), "VARCHAR(255)", "VARCHAR(255 /* max */)", 1),
+		"InnerWhitespace":    strings.Replace(strings.Replace(original, "CREATE TABLE users (", "CREATE  TABLE\tusers(", 1), "VARCHAR(255)", "VARCHAR( 255 )", 1),
+	}
+	for name, script := range cosmetic {
+		t.Run(name, func(t *testing.T) {
+			if normalized.Sum(script) != normalized.Sum(original) {
+				t.Errorf("Expected a matching checksum. Normalized to:\n%s", normalizeScript(script, normalizationLexicalRules))
+			}
+		})
+	}
+
+	changed := map[string]string{
+		"Statement":     strings.Replace(original, "VARCHAR(255)", "VARCHAR(100)", 1),
+		"Indentation":   strings.Replace(original, "  name", "name", 1),
+		"StringLiteral": "INSERT INTO t VALUES ('-- kept');",
+		"DollarQuoted":  "CREATE FUNCTION f() RETURNS TEXT AS $$ SELECT '--' || 'it''s' /* kept */ $$ LANGUAGE SQL;",
+		"StringSpacing": "INSERT INTO t VALUES ('a  b');",
+	}
+	for name, script := range changed {
+		t.Run(name, func(t *testing.T) {
+			if normalized.Sum(script) == normalized.Sum(original) {
+				t.Errorf("Expected a different checksum")
+			}
+		})
+	}
+	for _, kept := range []string{"'-- kept'", "$$ SELECT '--' || 'it''s' /* kept */ $$", "'a  b'"} {
+		script := strings.Join([]string{changed["StringLiteral"], changed["DollarQuoted"], changed["StringSpacing"]}, "\n")
+		if !strings.Contains(normalizeScript(script, normalizationLexicalRules), kept) {
+			t.Errorf("Expected %s to be kept inside its string", kept)
+		}
+	}
+	if normalized.Sum("INSERT INTO t VALUES ('a  b');") == normalized.Sum("INSERT INTO t VALUES ('a b');") {
+		t.Errorf("Expected whitespace inside strings to be significant")
+	}
+
+	// Comments and whitespace still separate tokens which would otherwise
+	// run together
+	for script, distinct := range map[string]string{
+		"SELECT/**/2;":  "SELECT2;",
+		"SELECT a -- x": "SELECTa",
+		"SELECT 1 - -1": "SELECT 1--1",
+		"SELECT a < -b": "SELECT a <-b",
+	} {
+		if normalized.Sum(script) == normalized.Sum(distinct) {
+			t.Errorf("Expected %q and %q to have different checksums. Both normalized to:\n%s", script, distinct, normalizeScript(script, normalizationLexicalRules))
+		}
+	}
+}
+
+// TestNormalizedChecksumUsesDialectRules ensures that a Migrator finds the
+// comments in a Script as its Dialect would, so that changes to string
+// literals which only look like comments are still detected
+func TestNormalizedChecksumUsesDialectRules(t *testing.T) {
+	tests := map[string]struct {
+		dialect  Dialect
+		original string
+		changed  string
+	}{
+		"MySQLBackslashEscape": {MySQL, `SELECT 'It\'s -- x';`, `SELECT 'It\'s -- y';`},
+		"MySQLDashesNoSpace":   {MySQL, "SELECT 1--1;", "SELECT 1--2;"},
+		"PostgresEscapeString": {Postgres, `SELECT E'It\'s -- x';`, `SELECT E'It\'s -- y';`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			migrator := NewMigrator(WithDialect(test.dialect), WithChecksumAlgorithm(NormalizedChecksum(SHA256Checksum)))
+			original := migrator.checksum(&Migration{Script: test.original})
+			changed := migrator.checksum(&Migration{Script: test.changed})
+			if original == changed {
+				t.Errorf("Expected the change from %q to %q to change the checksum", test.original, test.changed)
+			}
+			if migrator.checksumLike(&Migration{Script: test.changed}, original) == original {
+				t.Errorf("Expected the recorded checksum to be recomputed with the same rules")
+			}
+		})
+	}
+}
+
+func TestValidateWithNormalizedChecksums(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithChecksumAlgorithm(NormalizedChecksum(SHA256Checksum)))
+		migration := &Migration{ID: "2021-01-01 Normalized", Script: "-- Nothing to do\nSELECT 1;\n"}
+		err := migrator.Apply(db, []*Migration{migration})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A default Migrator still verifies the normalized checksums
+		verifier := NewMigrator(WithDialect(tdb.Dialect), WithTableName(migrator.TableName))
+		for _, script := range []string{"SELECT 1;   \r\n", "SELECT /* one */ 1 ;"} {
+			_, err = verifier.Validate(db, []*Migration{{ID: migration.ID, Script: script}})
+			if err != nil {
+				t.Errorf("Expected a cosmetic edit to pass validation. Got %v", err)
+			}
+		}
+		_, err = verifier.Validate(db, []*Migration{{ID: migration.ID, Script: "SELECT 2;\n"}})
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("Expected ErrChecksumMismatch. Got %v", err)
+		}
+	})
+}
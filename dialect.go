@@ -1,6 +1,9 @@
 package schema
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Dialect defines the minimal interface for a database dialect. All dialects
 // must implement functions to create the migrations table, get all applied
@@ -16,8 +19,67 @@ type Dialect interface {
 
 // Locker defines an optional Dialect extension for obtaining and releasing
 // a global database lock during the running of migrations. This feature is
-// supported by PostgreSQL and MySQL, but not SQLite.
+// supported by all of the built-in dialects. SQLite uses a lock table.
 type Locker interface {
 	Lock(ctx context.Context, tx Queryer, tableName string) error
 	Unlock(ctx context.Context, tx Queryer, tableName string) error
 }
+
+// TimeoutLocker defines an optional Locker extension for dialects which can
+// give up waiting for the lock after the timeout configured by
+// WithLockTimeout. Implementations return ErrLockTimeout when the lock is
+// not obtained in time.
+type TimeoutLocker interface {
+	LockWithTimeout(ctx context.Context, tx Queryer, tableName string, timeout time.Duration) error
+}
+
+// LockInspector defines an optional Locker extension for reporting whether
+// the lock for a tracking table is currently held, and by whom. It is used by
+// Migrator.LockStatus.
+type LockInspector interface {
+	LockStatus(ctx context.Context, tx Queryer, tableName string) (*LockStatus, error)
+}
+
+// LockKeyer defines an optional Locker extension for locks which can be
+// identified by an application-chosen namespace as well as by the tracking
+// table's name, so that unrelated applications which share a database and a
+// tracking table name don't block each other. It is used by WithLockKey.
+type LockKeyer interface {
+	KeyedLocker(namespace string) Locker
+}
+
+// ExtendedTracker defines an optional Dialect extension for tracking tables
+// which also record who applied each migration, from which host, with which
+// application version, and the Script which was run. It is used by
+// WithExtendedTracking.
+type ExtendedTracker interface {
+	// ExtendMigrationsTable adds the extended columns to the tracking table
+	// created by CreateMigrationsTable, unless it already has them
+	ExtendMigrationsTable(ctx context.Context, tx Queryer, tableName string) error
+	InsertExtendedAppliedMigration(ctx context.Context, tx Queryer, tableName string, migration *AppliedMigration) error
+	GetExtendedAppliedMigrations(ctx context.Context, tx Queryer, tableName string) (applied []*AppliedMigration, err error)
+}
+
+// HelperTables defines an optional Dialect extension for the SQL used by the
+// tables the package keeps alongside the tracking table, such as the lease,
+// meta and history tables. All of the built-in dialects implement it. A
+// Dialect which wraps one of them, as a CockroachDB Dialect might wrap
+// Postgres, should implement it by delegating. Dialects which don't implement
+// it get CREATE TABLE IF NOT EXISTS and ? placeholders.
+type HelperTables interface {
+	// CreateTableIfNotExists creates tableName with the parenthesized
+	// columns, unless it already exists
+	CreateTableIfNotExists(ctx context.Context, tx Queryer, tableName, columns string) error
+
+	// Placeholder returns the placeholder for the nth (1-based) parameter of
+	// a query
+	Placeholder(n int) string
+}
+
+// StatementSplitter defines an optional Dialect extension for breaking a
+// migration's Script into individual statements, which are then executed one
+// at a time. Dialects which don't implement it have each Script executed as a
+// single statement.
+type StatementSplitter interface {
+	SplitStatements(script string) ([]Statement, error)
+}
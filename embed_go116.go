@@ -4,8 +4,11 @@
 package schema
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
+	"path"
 )
 
 // FSMigrations receives a filesystem (such as an embed.FS) and extracts all
@@ -36,3 +39,18 @@ func FSMigrations(filesystem fs.FS, glob string) (migrations []*Migration, err e
 	}
 	return migrations, nil
 }
+
+// FSSource loads the .sql files in a directory of a filesystem (such as an
+// embed.FS), as DirectorySource does for a directory on disk. It fails if the
+// directory doesn't exist.
+func FSSource(filesystem fs.FS, dirPath string) MigrationSource {
+	return MigrationSourceFunc(func(ctx context.Context) ([]*Migration, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := fs.Stat(filesystem, dirPath); errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("migrations directory does not exist: %w", err)
+		}
+		return FSMigrations(filesystem, path.Join(dirPath, "*.sql"))
+	})
+}
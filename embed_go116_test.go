@@ -4,7 +4,9 @@
 package schema
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"io/fs"
 	"testing"
 	"testing/fstest"
@@ -49,3 +51,23 @@ func TestFSMigrationsWithInvalidFiles(t *testing.T) {
 	_, err := FSMigrations(testfs, "invalid-migrations/*.sql")
 	expectErrorContains(t, err, "fake.sql")
 }
+
+func TestFSSource(t *testing.T) {
+	migrations, err := FSSource(exampleMigrations, "test-migrations/saas").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Errorf("Expected 2 migrations, got %d", len(migrations))
+	}
+
+	_, err = FSSource(exampleMigrations, "test-migrations/nonexistent").Load(context.Background())
+	expectErrorContains(t, err, "does not exist")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = FSSource(exampleMigrations, "test-migrations/saas").Load(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
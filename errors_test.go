@@ -52,6 +52,24 @@ func TestApplyWithNilDBProvidesHelpfulError(t *testing.T) {
 	})
 }
 
+func TestPlanWithNilDBProvidesHelpfulError(t *testing.T) {
+	migrator := NewMigrator()
+	_, err := migrator.Plan(nil, testMigrations(t, "useless-ansi"))
+	if !errors.Is(err, ErrNilDB) {
+		t.Errorf("Expected %v, got %v", ErrNilDB, err)
+	}
+}
+
+func TestPlanLockFailure(t *testing.T) {
+	migrator := NewMigrator()
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec("^SELECT pg_advisory_lock").WillReturnError(ErrLockFailed)
+	_, err := migrator.Plan(db, testMigrations(t, "useless-ansi"))
+	if err != ErrLockFailed {
+		t.Errorf("Expected err '%s', got '%s'", ErrLockFailed, err)
+	}
+}
+
 func TestApplyWithNoMigrations(t *testing.T) {
 	db, _, _ := sqlmock.New()
 	migrator := NewMigrator()
@@ -108,6 +126,73 @@ func TestApplyCreateFailure(t *testing.T) {
 	}
 }
 
+func TestApplyPerMigrationCommitsEachMigration(t *testing.T) {
+	migrator := NewMigrator(WithTransactionMode(PerMigration))
+	migrations := testMigrations(t, "useless-ansi")
+
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec("^SELECT pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec("^CREATE TABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("^SELECT id, checksum").WillReturnRows(sqlmock.NewRows([]string{"id", "checksum", "execution_time_in_millis", "applied_at"}))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("^SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectedErr := fmt.Errorf("second migration failed")
+	mock.ExpectExec("^SELECT 2").WillReturnError(expectedErr)
+	mock.ExpectRollback()
+	mock.ExpectExec("^SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := migrator.Apply(db, migrations)
+	if !errors.Is(err, expectedErr) {
+		t.Errorf("Expected err '%s', got '%v'", expectedErr, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyRunsNonTransactionalMigrationsOutsideTransactions(t *testing.T) {
+	migrator := NewMigrator()
+	migrations := []*Migration{
+		{ID: "2021-01-01 001", Script: "CREATE TABLE users (name TEXT)"},
+		{ID: "2021-01-01 002", Script: "CREATE INDEX CONCURRENTLY idx ON users (name)", NoTransaction: true},
+		{ID: "2021-01-01 003", Script: "ALTER TABLE users ADD email TEXT"},
+		{ID: "2021-01-01 004", Script: "ALTER TABLE users ADD phone TEXT"},
+	}
+
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec("^SELECT pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec("^CREATE TABLE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("^SELECT id, checksum").WillReturnRows(sqlmock.NewRows([]string{"id", "checksum", "execution_time_in_millis", "applied_at"}))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("^CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("^CREATE INDEX CONCURRENTLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("^ALTER TABLE users ADD email").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^ALTER TABLE users ADD phone").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("^SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := migrator.Apply(db, migrations)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestLockFailure(t *testing.T) {
 	bq := BadQueryer{}
 	migrator := NewMigrator()
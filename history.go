@@ -0,0 +1,212 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// historyTableSuffix is appended to the name of the tracking table to name
+// the table which records migration attempts
+const historyTableSuffix = "_history"
+
+// maxHistoryErrorLength is the number of characters of an error's text which
+// are kept in the history table
+const maxHistoryErrorLength = 4000
+
+// AttemptStatus describes the outcome of an attempt to apply a migration
+type AttemptStatus string
+
+const (
+	// AttemptApplied indicates a migration which was applied and committed
+	AttemptApplied AttemptStatus = "applied"
+
+	// AttemptFailed indicates a migration whose Script failed, or which
+	// couldn't be recorded in the tracking table
+	AttemptFailed AttemptStatus = "failed"
+
+	// AttemptRolledBack indicates a migration which ran successfully, but
+	// whose transaction was rolled back because a later migration in the
+	// same transaction failed
+	AttemptRolledBack AttemptStatus = "rolled back"
+)
+
+// MigrationAttempt is a record of one attempt to apply a migration, as kept
+// in the history table when WithHistory is enabled.
+type MigrationAttempt struct {
+	// ID is the ID of the attempted Migration
+	ID string
+
+	Status AttemptStatus
+
+	// Error is the text of the error which caused the attempt to fail
+	Error string
+
+	// StartedAt is the time at which the migration's Script began executing
+	StartedAt time.Time
+
+	// Duration is the time spent running the Script and recording it
+	Duration time.Duration
+
+	// Hostname and AppliedBy identify the host and operating system user
+	// which made the attempt
+	Hostname  string
+	AppliedBy string
+}
+
+// QuotedHistoryTableName returns the dialect-quoted fully-qualified name of
+// the table which records migration attempts
+func (m *Migrator) QuotedHistoryTableName() string {
+	return m.Dialect.QuotedTableName(m.SchemaName, m.TableName+historyTableSuffix)
+}
+
+// GetMigrationAttempts retrieves every recorded attempt to apply a
+// migration, in the order they were made. Attempts are only recorded when
+// WithHistory is enabled.
+func (m Migrator) GetMigrationAttempts(db Queryer) (attempts []*MigrationAttempt, err error) {
+	return m.historyTable().attempts(m.ctx, db)
+}
+
+// recordAttempt remembers the outcome of running a migration, to be written
+// to the history table by writeAttempts once its transaction has ended
+func (m *Migrator) recordAttempt(migration *Migration, startedAt time.Time, err error) {
+	if !m.history {
+		return
+	}
+	attempt := &MigrationAttempt{
+		ID:        migration.ID,
+		Status:    AttemptApplied,
+		StartedAt: startedAt,
+		Duration:  time.Since(startedAt),
+		Hostname:  localHostname,
+		AppliedBy: localUsername,
+	}
+	if err != nil {
+		attempt.Status = AttemptFailed
+		attempt.Error = err.Error()
+	}
+	m.attempts = append(m.attempts, attempt)
+}
+
+// rollBackAttempts marks the successful attempts recorded since the supplied
+// position as rolled back, because their transaction didn't commit
+func (m *Migrator) rollBackAttempts(since int) {
+	for _, attempt := range m.attempts[since:] {
+		if attempt.Status == AttemptApplied {
+			attempt.Status = AttemptRolledBack
+		}
+	}
+}
+
+// writeAttempts writes the recorded attempts to the history table. It must
+// be called outside of any transaction, so that the attempts of failed
+// migrations aren't rolled back with them.
+func (m *Migrator) writeAttempts(conn Queryer) error {
+	attempts := m.attempts
+	m.attempts = nil
+	if len(attempts) == 0 {
+		return nil
+	}
+
+	table := m.historyTable()
+	err := table.create(m.ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	// Attempts are numbered in the order they were made. The lock keeps
+	// other processes from writing attempts at the same time.
+	number, err := table.lastAttemptNumber(m.ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, attempt := range attempts {
+		number++
+		err = table.insert(m.ctx, conn, number, attempt)
+		if err != nil {
+			return fmt.Errorf("failed to record the attempt to apply '%s' in %s: %w", attempt.ID, table.name, err)
+		}
+	}
+	return nil
+}
+
+func (m Migrator) historyTable() historyTable {
+	return historyTable{dialect: m.Dialect, name: m.QuotedHistoryTableName()}
+}
+
+// historyTable runs the queries against the table which records migration
+// attempts. Times are stored as Unix milliseconds so that the same table
+// definition works everywhere.
+type historyTable struct {
+	dialect Dialect
+	name    string
+}
+
+// create creates the history table if it does not already exist
+func (t historyTable) create(ctx context.Context, tx Queryer) error {
+	return createTableIfNotExists(ctx, tx, t.dialect, t.name, `(
+			attempt_number BIGINT NOT NULL,
+			migration_id VARCHAR(255) NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			error_text VARCHAR(4000) NOT NULL,
+			started_at BIGINT NOT NULL,
+			duration_ms BIGINT NOT NULL,
+			hostname VARCHAR(255) NOT NULL,
+			applied_by VARCHAR(255) NOT NULL
+		)`)
+}
+
+// lastAttemptNumber returns the number of the latest recorded attempt, or 0
+// if there are none
+func (t historyTable) lastAttemptNumber(ctx context.Context, tx Queryer) (int64, error) {
+	var number sql.NullInt64
+	err := queryScalar(ctx, tx, &number, fmt.Sprintf(`SELECT MAX(attempt_number) FROM %s`, t.name))
+	return number.Int64, err
+}
+
+func (t historyTable) insert(ctx context.Context, tx Queryer, number int64, attempt *MigrationAttempt) error {
+	errorText := []rune(attempt.Error)
+	if len(errorText) > maxHistoryErrorLength {
+		errorText = errorText[:maxHistoryErrorLength]
+	}
+	query := bindPlaceholders(t.dialect, fmt.Sprintf(`
+		INSERT INTO %s
+		( attempt_number, migration_id, status, error_text, started_at, duration_ms, hostname, applied_by )
+		VALUES
+		( ?, ?, ?, ?, ?, ?, ?, ? )
+		`, t.name,
+	))
+	_, err := tx.ExecContext(ctx, query, number, attempt.ID, string(attempt.Status), string(errorText), attempt.StartedAt.UnixMilli(), attempt.Duration.Milliseconds(), attempt.Hostname, attempt.AppliedBy)
+	return err
+}
+
+func (t historyTable) attempts(ctx context.Context, tx Queryer) (attempts []*MigrationAttempt, err error) {
+	attempts = make([]*MigrationAttempt, 0)
+
+	query := fmt.Sprintf(`
+		SELECT migration_id, status, error_text, started_at, duration_ms, hostname, applied_by
+		FROM %s
+		ORDER BY attempt_number ASC
+	`, t.name)
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return attempts, err
+	}
+	defer func() { err = coalesceErrs(err, rows.Close()) }()
+
+	for rows.Next() {
+		attempt := MigrationAttempt{}
+		var status string
+		var startedAt, durationMillis int64
+		err = rows.Scan(&attempt.ID, &status, &attempt.Error, &startedAt, &durationMillis, &attempt.Hostname, &attempt.AppliedBy)
+		if err != nil {
+			return attempts, fmt.Errorf("failed to read %s: %w", t.name, err)
+		}
+		attempt.Status = AttemptStatus(status)
+		attempt.StartedAt = time.UnixMilli(startedAt)
+		attempt.Duration = time.Duration(durationMillis) * time.Millisecond
+		attempts = append(attempts, &attempt)
+	}
+	return attempts, rows.Err()
+}
@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithHistory())
+		migrations := testMigrations(t, "useless-ansi")
+		broken := &Migration{ID: "9999-01-01 Broken", Script: "SELECT * FROM nonexistent_table"}
+
+		// The whole batch is rolled back, but every attempt is recorded
+		err := migrator.Apply(db, append(migrations, broken))
+		if err == nil {
+			t.Fatal("Expected the broken migration to fail")
+		}
+		err = migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		attempts, err := migrator.GetMigrationAttempts(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(attempts) != 2*len(migrations)+1 {
+			t.Fatalf("Expected %d attempts. Got %d", 2*len(migrations)+1, len(attempts))
+		}
+		expected := make([]AttemptStatus, 0, len(attempts))
+		for range migrations {
+			expected = append(expected, AttemptRolledBack)
+		}
+		expected = append(expected, AttemptFailed)
+		for range migrations {
+			expected = append(expected, AttemptApplied)
+		}
+		for i, attempt := range attempts {
+			if attempt.Status != expected[i] {
+				t.Errorf("Expected attempt %d ('%s') to be %s. Got %s", i, attempt.ID, expected[i], attempt.Status)
+			}
+			if attempt.Hostname != localHostname || attempt.StartedAt.IsZero() {
+				t.Errorf("Expected attempt %d to record its host and start time. Got %+v", i, attempt)
+			}
+		}
+
+		failed := attempts[len(migrations)]
+		if failed.ID != broken.ID || !strings.Contains(failed.Error, "nonexistent_table") {
+			t.Errorf("Expected the broken migration's error to be recorded. Got %+v", failed)
+		}
+	})
+}
+
+func TestHistoryDisabledByDefault(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		err := migrator.Apply(db, testMigrations(t, "useless-ansi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = migrator.GetMigrationAttempts(db)
+		if err == nil {
+			t.Error("Expected no history table without WithHistory")
+		}
+	})
+}
@@ -0,0 +1,445 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Importer reads the history table of another migration tool, so that its
+// applied migrations can be recorded in the tracking table by Import. The
+// migrations' files must be supplied as Migrations named after the files, as
+// MigrationsFromDirectoryPath and FSMigrations do, and passed through the
+// Importer's Migrations method.
+type Importer interface {
+	// HistoryTableName is the unqualified name of the tool's history table
+	HistoryTableName() string
+
+	// Migrations returns the supplied Migrations without the tool's down
+	// migrations. Down migrations kept in their own files are left out, and
+	// down sections kept in the same file as the up migration are removed
+	// from its Script. The result is what Import and Apply must be given.
+	Migrations(migrations []*Migration) []*Migration
+
+	// Version extracts the tool's version from the ID of a Migration. It
+	// returns false for IDs which aren't named like the tool's migration
+	// files, which are never imported.
+	Version(id string) (version string, ok bool)
+
+	// AppliedVersions reads the tool's history table, returning the versions
+	// it records as applied with the times they were applied (zero when the
+	// tool doesn't record them). The versions of the supplied Migrations are
+	// provided for tools which only record the latest applied version.
+	AppliedVersions(ctx context.Context, tx Queryer, tableName string, versions []string) (map[string]time.Time, error)
+}
+
+// Import records the migrations which another migration tool has applied,
+// according to its history table, as applied in the tracking table, so that
+// Apply doesn't run them again. Each is matched to one of the supplied
+// Migrations by the version in its ID, and recorded with the checksum of its
+// Script. The recorded rows are reported as Baselined by GetAppliedMigrations.
+// Migrations which are already in the tracking table are left alone. The
+// history table isn't modified. Import holds the Migrator's lock, and records
+// every row in a single transaction.
+//
+// The migrations must have been passed through the importer's Migrations
+// method. Import refuses any which still hold down migrations, since Apply
+// would run them.
+func (m *Migrator) Import(db DB, migrations []*Migration, importer Importer) error {
+	if db == nil {
+		return ErrNilDB
+	}
+	if importer.HistoryTableName() == m.TableName {
+		return fmt.Errorf("can't import from %s into itself. Use WithTableName to choose another tracking table", m.QuotedTableName())
+	}
+	historyTable := m.Dialect.QuotedTableName(m.SchemaName, importer.HistoryTableName())
+
+	upScripts := make(map[string]string, len(migrations))
+	for _, migration := range importer.Migrations(migrations) {
+		upScripts[migration.ID] = migration.Script
+	}
+	for _, migration := range migrations {
+		if script, isUp := upScripts[migration.ID]; !isUp || script != migration.Script {
+			return fmt.Errorf("can't import from %s: '%s' holds a down migration. Pass the migrations through the importer's Migrations method, and Apply only those", historyTable, migration.ID)
+		}
+	}
+
+	return m.inLockedTx(db, func(tx Queryer) error {
+		byVersion := make(map[string]*Migration)
+		versions := make([]string, 0)
+		for _, migration := range migrations {
+			version, ok := importer.Version(migration.ID)
+			if !ok {
+				continue
+			}
+			if other, exists := byVersion[version]; exists {
+				return fmt.Errorf("can't import from %s: '%s' and '%s' both have version %s", historyTable, other.ID, migration.ID, version)
+			}
+			byVersion[version] = migration
+			versions = append(versions, version)
+		}
+
+		imported, err := importer.AppliedVersions(m.ctx, tx, historyTable, versions)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", historyTable, err)
+		}
+		applied, err := m.GetAppliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+
+		importedVersions := make([]string, 0, len(imported))
+		for version := range imported {
+			importedVersions = append(importedVersions, version)
+		}
+		sort.Slice(importedVersions, func(i, j int) bool {
+			return compareVersions(importedVersions[i], importedVersions[j]) < 0
+		})
+
+		now := time.Now()
+		for _, version := range importedVersions {
+			migration, exists := byVersion[version]
+			if !exists {
+				m.log(fmt.Sprintf("WARNING: %s records version %s as applied, but none of the supplied migrations has that version", historyTable, version))
+				continue
+			}
+			if _, isApplied := applied[migration.ID]; isApplied {
+				continue
+			}
+			appliedAt := imported[version]
+			if appliedAt.IsZero() {
+				appliedAt = now
+			}
+			err = m.insertUnexecutedMigration(tx, migration, appliedAt)
+			if err != nil {
+				return err
+			}
+			m.log(fmt.Sprintf("Imported '%s' from %s", migration.ID, historyTable))
+		}
+		return nil
+	})
+}
+
+// GolangMigrateImporter imports from golang-migrate, whose schema_migrations
+// table records only the latest applied version and whether it failed
+// (dirty). Migrations are read from its *.up.sql files, and its *.down.sql
+// files are left out by Migrations. A dirty history table can't be imported.
+type GolangMigrateImporter struct {
+	// TableName overrides the name of the history table, which defaults to
+	// schema_migrations
+	TableName string
+}
+
+// HistoryTableName implements the Importer interface
+func (i GolangMigrateImporter) HistoryTableName() string {
+	return defaultString(i.TableName, "schema_migrations")
+}
+
+var (
+	golangMigrateFilename     = regexp.MustCompile(`^(\d+)_.*\.up$`)
+	golangMigrateDownFilename = regexp.MustCompile(`^\d+_.*\.down$`)
+)
+
+// Migrations implements the Importer interface
+func (i GolangMigrateImporter) Migrations(migrations []*Migration) []*Migration {
+	return withoutIDs(migrations, golangMigrateDownFilename)
+}
+
+// Version implements the Importer interface
+func (i GolangMigrateImporter) Version(id string) (string, bool) {
+	return numericVersion(golangMigrateFilename, id)
+}
+
+// AppliedVersions implements the Importer interface. Every supplied version
+// up to the recorded one is applied.
+func (i GolangMigrateImporter) AppliedVersions(ctx context.Context, tx Queryer, tableName string, versions []string) (map[string]time.Time, error) {
+	applied := make(map[string]time.Time)
+
+	var current int64
+	var dirty bool
+	found, err := queryRow(ctx, tx, fmt.Sprintf(`SELECT version, dirty FROM %s`, tableName), nil, &current, &dirty)
+	if err != nil || !found {
+		return applied, err
+	}
+	if dirty {
+		return applied, fmt.Errorf("version %d is dirty. Resolve it with golang-migrate first", current)
+	}
+	for _, version := range versions {
+		if compareVersions(version, strconv.FormatInt(current, 10)) <= 0 {
+			applied[version] = time.Time{}
+		}
+	}
+	return applied, nil
+}
+
+// GooseImporter imports from goose, whose goose_db_version table records
+// each time a version was applied or rolled back. goose keeps each down
+// migration in the same file as its up migration, after a "-- +goose Down"
+// annotation, which Migrations removes.
+type GooseImporter struct {
+	// TableName overrides the name of the history table, which defaults to
+	// goose_db_version
+	TableName string
+}
+
+// HistoryTableName implements the Importer interface
+func (i GooseImporter) HistoryTableName() string {
+	return defaultString(i.TableName, "goose_db_version")
+}
+
+var (
+	gooseFilename    = regexp.MustCompile(`^(\d+)_`)
+	gooseDownSection = regexp.MustCompile(`(?mi)^--\s*\+goose\s+down\b`)
+)
+
+// Migrations implements the Importer interface
+func (i GooseImporter) Migrations(migrations []*Migration) []*Migration {
+	return withoutDownSections(migrations, gooseDownSection)
+}
+
+// Version implements the Importer interface
+func (i GooseImporter) Version(id string) (string, bool) {
+	return numericVersion(gooseFilename, id)
+}
+
+// AppliedVersions implements the Importer interface. A version is applied
+// when its latest record says so.
+func (i GooseImporter) AppliedVersions(ctx context.Context, tx Queryer, tableName string, versions []string) (applied map[string]time.Time, err error) {
+	applied = make(map[string]time.Time)
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT version_id, is_applied, tstamp FROM %s ORDER BY id ASC`, tableName))
+	if err != nil {
+		return applied, err
+	}
+	defer func() { err = coalesceErrs(err, rows.Close()) }()
+
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var tstamp mysqlTime
+		err = rows.Scan(&version, &isApplied, &tstamp)
+		if err != nil {
+			return applied, err
+		}
+		switch {
+		case version == 0:
+			// goose records version 0 when it creates its table
+		case isApplied:
+			applied[strconv.FormatInt(version, 10)] = tstamp.Value
+		default:
+			delete(applied, strconv.FormatInt(version, 10))
+		}
+	}
+	return applied, rows.Err()
+}
+
+// FlywayImporter imports the versioned migrations recorded in Flyway's
+// flyway_schema_history table, including those covered by a baseline.
+// Repeatable (R__) migrations have no version, and aren't imported. Undo
+// (U__) migrations are left out by Migrations.
+type FlywayImporter struct {
+	// TableName overrides the name of the history table, which defaults to
+	// flyway_schema_history
+	TableName string
+}
+
+// HistoryTableName implements the Importer interface
+func (i FlywayImporter) HistoryTableName() string {
+	return defaultString(i.TableName, "flyway_schema_history")
+}
+
+var (
+	flywayFilename     = regexp.MustCompile(`^V(\d[\d._]*?)__`)
+	flywayUndoFilename = regexp.MustCompile(`^U\d[\d._]*?__`)
+)
+
+// Migrations implements the Importer interface
+func (i FlywayImporter) Migrations(migrations []*Migration) []*Migration {
+	return withoutIDs(migrations, flywayUndoFilename)
+}
+
+// Version implements the Importer interface. Underscores in the versions of
+// Flyway's files are recorded as dots.
+func (i FlywayImporter) Version(id string) (string, bool) {
+	match := flywayFilename.FindStringSubmatch(id)
+	if match == nil {
+		return "", false
+	}
+	return strings.ReplaceAll(match[1], "_", "."), true
+}
+
+// AppliedVersions implements the Importer interface
+func (i FlywayImporter) AppliedVersions(ctx context.Context, tx Queryer, tableName string, versions []string) (applied map[string]time.Time, err error) {
+	applied = make(map[string]time.Time)
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT version, type, installed_on, success FROM %s ORDER BY installed_rank ASC`, tableName))
+	if err != nil {
+		return applied, err
+	}
+	defer func() { err = coalesceErrs(err, rows.Close()) }()
+
+	for rows.Next() {
+		var version sql.NullString
+		var kind string
+		var installedOn mysqlTime
+		var success bool
+		err = rows.Scan(&version, &kind, &installedOn, &success)
+		if err != nil {
+			return applied, err
+		}
+		if !version.Valid || !success {
+			continue
+		}
+		switch kind {
+		case "BASELINE":
+			// Every version up to the baseline is considered applied
+			for _, v := range versions {
+				if compareVersions(v, version.String) <= 0 {
+					applied[v] = installedOn.Value
+				}
+			}
+		case "UNDO_SQL", "UNDO_JDBC", "DELETE":
+			delete(applied, version.String)
+		default:
+			applied[version.String] = installedOn.Value
+		}
+	}
+	return applied, rows.Err()
+}
+
+// DbmateImporter imports from dbmate, whose schema_migrations table holds
+// the version of each applied migration. dbmate keeps each down migration in
+// the same file as its up migration, after a "-- migrate:down" comment, which
+// Migrations removes.
+type DbmateImporter struct {
+	// TableName overrides the name of the history table, which defaults to
+	// schema_migrations
+	TableName string
+}
+
+// HistoryTableName implements the Importer interface
+func (i DbmateImporter) HistoryTableName() string {
+	return defaultString(i.TableName, "schema_migrations")
+}
+
+var (
+	dbmateFilename    = regexp.MustCompile(`^(\d+)_`)
+	dbmateDownSection = regexp.MustCompile(`(?m)^--\s*migrate:down\b`)
+)
+
+// Migrations implements the Importer interface
+func (i DbmateImporter) Migrations(migrations []*Migration) []*Migration {
+	return withoutDownSections(migrations, dbmateDownSection)
+}
+
+// Version implements the Importer interface. dbmate records versions exactly
+// as they appear in its filenames.
+func (i DbmateImporter) Version(id string) (string, bool) {
+	match := dbmateFilename.FindStringSubmatch(id)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// AppliedVersions implements the Importer interface
+func (i DbmateImporter) AppliedVersions(ctx context.Context, tx Queryer, tableName string, versions []string) (applied map[string]time.Time, err error) {
+	applied = make(map[string]time.Time)
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT version FROM %s`, tableName))
+	if err != nil {
+		return applied, err
+	}
+	defer func() { err = coalesceErrs(err, rows.Close()) }()
+
+	for rows.Next() {
+		var version string
+		err = rows.Scan(&version)
+		if err != nil {
+			return applied, err
+		}
+		applied[version] = time.Time{}
+	}
+	return applied, rows.Err()
+}
+
+// withoutIDs returns the migrations whose IDs don't match pattern
+func withoutIDs(migrations []*Migration, pattern *regexp.Regexp) []*Migration {
+	kept := make([]*Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		if !pattern.MatchString(migration.ID) {
+			kept = append(kept, migration)
+		}
+	}
+	return kept
+}
+
+// withoutDownSections returns the migrations with their Scripts cut off where
+// the down section marked by pattern begins. Migrations with down sections
+// are copied rather than modified.
+func withoutDownSections(migrations []*Migration, pattern *regexp.Regexp) []*Migration {
+	kept := make([]*Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		if loc := pattern.FindStringIndex(migration.Script); loc != nil {
+			up := *migration
+			up.Script = migration.Script[:loc[0]]
+			migration = &up
+		}
+		kept = append(kept, migration)
+	}
+	return kept
+}
+
+// numericVersion extracts the integer version captured by pattern from id,
+// without leading zeros, as tools which store versions as integers do
+func numericVersion(pattern *regexp.Regexp, id string) (string, bool) {
+	match := pattern.FindStringSubmatch(id)
+	if match == nil {
+		return "", false
+	}
+	version := strings.TrimLeft(match[1], "0")
+	if version == "" {
+		version = "0"
+	}
+	return version, true
+}
+
+// compareVersions compares two dotted versions made of digits, part by part
+// and numerically, returning -1, 0 or 1. Missing parts count as zero.
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := versionPart(aParts, i), versionPart(bParts, i)
+		if len(aPart) != len(bPart) {
+			if len(aPart) < len(bPart) {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(aPart, bPart); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// versionPart returns the ith part of a dotted version without leading
+// zeros, or an empty string if there is no such part
+func versionPart(parts []string, i int) string {
+	if i >= len(parts) {
+		return ""
+	}
+	return strings.TrimLeft(parts[i], "0")
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,259 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Interface verification that the built-in importers are valid Importers
+var (
+	_ Importer = GolangMigrateImporter{}
+	_ Importer = GooseImporter{}
+	_ Importer = FlywayImporter{}
+	_ Importer = DbmateImporter{}
+)
+
+func TestImporterVersion(t *testing.T) {
+	tests := []struct {
+		importer Importer
+		id       string
+		version  string
+		ok       bool
+	}{
+		{GolangMigrateImporter{}, "000001_create_users.up", "1", true},
+		{GolangMigrateImporter{}, "20210101120000_create_users.up", "20210101120000", true},
+		{GolangMigrateImporter{}, "000001_create_users.down", "", false},
+		{GooseImporter{}, "00002_add_email", "2", true},
+		{GooseImporter{}, "add_email", "", false},
+		{FlywayImporter{}, "V1_1__Create_users", "1.1", true},
+		{FlywayImporter{}, "V2__Add.email", "2", true},
+		{FlywayImporter{}, "R__Refresh_views", "", false},
+		{DbmateImporter{}, "20210101120000_create_users", "20210101120000", true},
+		{DbmateImporter{}, "001_create_users", "001", true},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%T/%s", test.importer, test.id), func(t *testing.T) {
+			version, ok := test.importer.Version(test.id)
+			if version != test.version || ok != test.ok {
+				t.Errorf("Expected (%s, %t). Got (%s, %t)", test.version, test.ok, version, ok)
+			}
+		})
+	}
+}
+
+func TestImporterMigrations(t *testing.T) {
+	tests := []struct {
+		importer Importer
+		script   string
+		up       string
+	}{
+		{GooseImporter{}, "-- +goose Up\nCREATE TABLE a (id INT);\n-- +goose Down\nDROP TABLE a;\n", "-- +goose Up\nCREATE TABLE a (id INT);\n"},
+		{GooseImporter{}, "-- +goose up\nSELECT 1;\n--  +goose down\nSELECT 2;", "-- +goose up\nSELECT 1;\n"},
+		{GooseImporter{}, "-- +goose Up\nSELECT '-- +goose Down';", "-- +goose Up\nSELECT '-- +goose Down';"},
+		{DbmateImporter{}, "-- migrate:up\nCREATE TABLE a (id INT);\n\n-- migrate:down\nDROP TABLE a;\n", "-- migrate:up\nCREATE TABLE a (id INT);\n\n"},
+		{DbmateImporter{}, "-- migrate:up\nSELECT 1;", "-- migrate:up\nSELECT 1;"},
+	}
+	for _, test := range tests {
+		original := &Migration{ID: "1_a", Script: test.script}
+		migrations := test.importer.Migrations([]*Migration{original})
+		if len(migrations) != 1 || migrations[0].ID != original.ID || migrations[0].Script != test.up {
+			t.Errorf("Expected %T to keep %q of %q", test.importer, test.up, test.script)
+		}
+		if original.Script != test.script {
+			t.Errorf("Expected %T not to modify the supplied Migration", test.importer)
+		}
+	}
+
+	filenames := []struct {
+		importer Importer
+		ids      []string
+		kept     []string
+	}{
+		{GolangMigrateImporter{}, []string{"1_a.up", "1_a.down", "2_b.up", "2_b.down"}, []string{"1_a.up", "2_b.up"}},
+		{FlywayImporter{}, []string{"V1__a", "U1__a", "R__b", "V1_1__c", "U1_1__c"}, []string{"V1__a", "R__b", "V1_1__c"}},
+	}
+	for _, test := range filenames {
+		migrations := make([]*Migration, 0, len(test.ids))
+		for _, id := range test.ids {
+			migrations = append(migrations, &Migration{ID: id})
+		}
+		kept := make([]string, 0)
+		for _, migration := range test.importer.Migrations(migrations) {
+			kept = append(kept, migration.ID)
+		}
+		if strings.Join(kept, ",") != strings.Join(test.kept, ",") {
+			t.Errorf("Expected %T to keep %v. Got %v", test.importer, test.kept, kept)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1", "1", 0},
+		{"1", "2", -1},
+		{"10", "9", 1},
+		{"1.1", "1.01", 0},
+		{"1.1", "1.10", -1},
+		{"2", "1.9", 1},
+		{"1", "1.0", 0},
+	}
+	for _, test := range tests {
+		if actual := compareVersions(test.a, test.b); actual != test.expected {
+			t.Errorf("Expected compareVersions(%s, %s) to be %d. Got %d", test.a, test.b, test.expected, actual)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	suffix := time.Now().UnixNano()
+	tests := map[string]struct {
+		importer   Importer
+		setup      []string
+		migrations []*Migration
+	}{
+		"GolangMigrate": {
+			importer: GolangMigrateImporter{TableName: fmt.Sprintf("golang_migrate_%d", suffix)},
+			setup: []string{
+				`CREATE TABLE golang_migrate_%d (version BIGINT NOT NULL, dirty BOOLEAN NOT NULL)`,
+				`INSERT INTO golang_migrate_%d VALUES (2, false)`,
+			},
+			migrations: []*Migration{
+				{ID: "000001_create_users.up", Script: "THIS IS NOT SQL"},
+				{ID: "000001_create_users.down", Script: "NOR IS THIS"},
+				{ID: "000002_add_email.up", Script: "NOR THIS"},
+				{ID: "000003_add_phone.up", Script: "SELECT 1;"},
+			},
+		},
+		"Goose": {
+			importer: GooseImporter{TableName: fmt.Sprintf("goose_%d", suffix)},
+			setup: []string{
+				`CREATE TABLE goose_%d (id INTEGER PRIMARY KEY, version_id BIGINT NOT NULL, is_applied BOOLEAN NOT NULL, tstamp TIMESTAMP)`,
+				`INSERT INTO goose_%d VALUES (1, 0, true, '2021-01-01 00:00:00'), (2, 1, true, '2021-01-02 00:00:00'), (3, 2, true, '2021-01-03 00:00:00'), (4, 3, true, '2021-01-04 00:00:00'), (5, 3, false, '2021-01-05 00:00:00')`,
+			},
+			migrations: []*Migration{
+				{ID: "00001_create_users", Script: "THIS IS NOT SQL"},
+				{ID: "00002_add_email", Script: "NOR THIS"},
+				{ID: "00003_add_phone", Script: "-- +goose Up\nSELECT 1;\n-- +goose Down\nNOR IS THIS"},
+			},
+		},
+		"Flyway": {
+			importer: FlywayImporter{TableName: fmt.Sprintf("flyway_%d", suffix)},
+			setup: []string{
+				`CREATE TABLE flyway_%d (installed_rank INTEGER NOT NULL, version VARCHAR(50), description VARCHAR(200), type VARCHAR(20) NOT NULL, script VARCHAR(1000), installed_on TIMESTAMP, success BOOLEAN NOT NULL)`,
+				`INSERT INTO flyway_%d VALUES (1, '1', '<< Flyway Baseline >>', 'BASELINE', '<< Flyway Baseline >>', '2021-01-01 00:00:00', true), (2, '1.1', 'Add email', 'SQL', 'V1_1__Add_email.sql', '2021-01-02 00:00:00', true), (3, NULL, 'Views', 'SQL', 'R__Views.sql', '2021-01-02 00:00:00', true), (4, '2', 'Add phone', 'SQL', 'V2__Add_phone.sql', '2021-01-03 00:00:00', false)`,
+			},
+			migrations: []*Migration{
+				{ID: "V1__Create_users", Script: "THIS IS NOT SQL"},
+				{ID: "V1_1__Add_email", Script: "NOR THIS"},
+				{ID: "R__Views", Script: "SELECT 1;"},
+				{ID: "V2__Add_phone", Script: "SELECT 1;"},
+				{ID: "U2__Add_phone", Script: "NOR IS THIS"},
+			},
+		},
+		"Dbmate": {
+			importer: DbmateImporter{TableName: fmt.Sprintf("dbmate_%d", suffix)},
+			setup: []string{
+				`CREATE TABLE dbmate_%d (version VARCHAR(128) PRIMARY KEY)`,
+				`INSERT INTO dbmate_%d VALUES ('20210101000000'), ('20210102000000')`,
+			},
+			migrations: []*Migration{
+				{ID: "20210101000000_create_users", Script: "THIS IS NOT SQL"},
+				{ID: "20210102000000_add_email", Script: "NOR THIS"},
+				{ID: "20210103000000_add_phone", Script: "-- migrate:up\nSELECT 1;\n-- migrate:down\nNOR IS THIS"},
+			},
+		},
+	}
+
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				for _, query := range test.setup {
+					_, err := db.Exec(fmt.Sprintf(query, suffix))
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				var lines LogLines
+				migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithLogger(&lines))
+				migrations := test.importer.Migrations(test.migrations)
+				err := migrator.Import(db, migrations, test.importer)
+				if err != nil {
+					t.Fatal(err)
+				}
+				applied, err := migrator.GetAppliedMigrations(db)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, migration := range migrations {
+					if strings.Contains(migration.Script, "NOR IS THIS") {
+						t.Fatalf("Expected the down migration in '%s' to be left out", migration.ID)
+					}
+					_, isApplied := applied[migration.ID]
+					shouldBe := !strings.Contains(migration.Script, "SELECT 1;")
+					if isApplied != shouldBe {
+						t.Errorf("Expected '%s' to be imported: %t. Got %t", migration.ID, shouldBe, isApplied)
+					}
+					if isApplied && (!applied[migration.ID].Baselined || !lines.Contains("Imported '"+migration.ID+"'")) {
+						t.Errorf("Expected '%s' to be marked and logged as imported", migration.ID)
+					}
+				}
+
+				// Importing again is harmless, and the imported migrations
+				// aren't run
+				err = migrator.Import(db, migrations, test.importer)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = migrator.Apply(db, migrations)
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+}
+
+func TestImportErrors(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		table := fmt.Sprintf("dirty_%d", time.Now().UnixNano())
+		_, err := db.Exec(fmt.Sprintf(`CREATE TABLE %s (version BIGINT NOT NULL, dirty BOOLEAN NOT NULL)`, table))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(fmt.Sprintf(`INSERT INTO %s VALUES (1, true)`, table))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		migrations := []*Migration{{ID: "1_create_users.up", Script: "SELECT 1;"}}
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		err = migrator.Import(db, migrations, GolangMigrateImporter{TableName: table})
+		expectErrorContains(t, err, "version 1 is dirty")
+
+		migrator = NewMigrator(WithDialect(tdb.Dialect))
+		err = migrator.Import(db, migrations, DbmateImporter{})
+		expectErrorContains(t, err, "into itself")
+
+		err = makeTestMigrator(WithDialect(tdb.Dialect)).Import(db, append(migrations, &Migration{ID: "01_duplicate.up"}), GolangMigrateImporter{TableName: table})
+		expectErrorContains(t, err, "both have version 1")
+
+		err = makeTestMigrator(WithDialect(tdb.Dialect)).Import(db, append(migrations, &Migration{ID: "1_create_users.down"}), GolangMigrateImporter{TableName: table})
+		expectErrorContains(t, err, "'1_create_users.down' holds a down migration")
+
+		withDownSection := []*Migration{{ID: "1_create_users", Script: "-- migrate:up\nSELECT 1;\n-- migrate:down\nSELECT 2;"}}
+		err = makeTestMigrator(WithDialect(tdb.Dialect)).Import(db, withDownSection, DbmateImporter{TableName: table})
+		expectErrorContains(t, err, "'1_create_users' holds a down migration")
+	})
+}
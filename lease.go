@@ -0,0 +1,349 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultLeaseTTL is how long a LeaseLocker's lease is honored without
+	// being renewed by a heartbeat
+	DefaultLeaseTTL = 30 * time.Second
+
+	// DefaultHeartbeatInterval is how often a LeaseLocker renews its lease
+	DefaultHeartbeatInterval = 10 * time.Second
+
+	// leaseNameLength is the size of the lease table's lock_name column
+	leaseNameLength = 255
+)
+
+// LeaseLocker is a Locker for databases which lack advisory locks, such as
+// CockroachDB, or which sit behind proxies that break session-level locks,
+// such as PgBouncer in transaction mode. The lock is a lease row in the
+// DefaultLockTableName table, holding the holder's ID and hostname along with
+// the times it was acquired and expires.
+//
+// While the lock is held, a heartbeat renews the lease on a separate
+// connection from DB, so the DB must allow at least two connections. A lease
+// which expires because its holder stopped renewing it is taken over by the
+// next process which asks for the lock. Expiry uses the clocks of the
+// migrating processes, so TTL should comfortably exceed any clock skew
+// between them.
+//
+// Any Dialect can be used with a LeaseLocker. Dialects other than the
+// built-in ones should implement HelperTables unless the database accepts
+// CREATE TABLE IF NOT EXISTS and ? placeholders. Usage:
+//
+//	locker := NewLeaseLocker(db, Postgres)
+//	migrator := NewMigrator(WithDialect(Postgres), WithLocker(locker))
+type LeaseLocker struct {
+	// TableName is the name of the table which holds the lease rows. It
+	// defaults to DefaultLockTableName.
+	TableName string
+
+	// TTL is how long a lease is honored without being renewed
+	TTL time.Duration
+
+	// HeartbeatInterval is how often the lease is renewed while it is held
+	HeartbeatInterval time.Duration
+
+	db      DB
+	dialect Dialect
+
+	mu     sync.Mutex
+	leases map[string]*lease
+}
+
+// lease tracks a table-based lock held by a LeaseLocker or the SQLite
+// dialect
+type lease struct {
+	holderID string
+	stop     chan struct{}
+	done     chan struct{}
+	lost     atomic.Bool
+}
+
+func newLease(holderID string) *lease {
+	return &lease{
+		holderID: holderID,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// heartbeat calls renew every interval until the lease is released, or until
+// renew reports that it was taken over by another process. A non-positive
+// interval disables renewal.
+func (held *lease) heartbeat(interval time.Duration, renew func() (bool, error)) {
+	defer close(held.done)
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-held.stop:
+			return
+		case <-ticker.C:
+			renewed, err := renew()
+			if err == nil && !renewed {
+				held.lost.Store(true)
+				return
+			}
+		}
+	}
+}
+
+// stopHeartbeat stops renewing the lease, reporting whether it was lost
+func (held *lease) stopHeartbeat() (lost bool) {
+	close(held.stop)
+	<-held.done
+	return held.lost.Load()
+}
+
+// NewLeaseLocker creates a LeaseLocker which stores its lease rows using the
+// supplied Dialect's quoting and placeholders, and which renews them on
+// connections from db.
+func NewLeaseLocker(db DB, dialect Dialect) *LeaseLocker {
+	return &LeaseLocker{
+		TableName:         DefaultLockTableName,
+		TTL:               DefaultLeaseTTL,
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		db:                db,
+		dialect:           dialect,
+		leases:            make(map[string]*lease),
+	}
+}
+
+// Lock implements the Locker interface, waiting until the lease for
+// tableName can be obtained
+func (l *LeaseLocker) Lock(ctx context.Context, tx Queryer, tableName string) error {
+	return l.LockWithTimeout(ctx, tx, tableName, -1)
+}
+
+// LockWithTimeout implements the TimeoutLocker interface by polling for the
+// lease until it is obtained or the timeout expires
+func (l *LeaseLocker) LockWithTimeout(ctx context.Context, tx Queryer, tableName string, timeout time.Duration) error {
+	table := l.table()
+	holderID := newLockHolderID()
+	err := pollLock(ctx, timeout, func() (bool, error) {
+		return table.tryAcquire(ctx, tx, tableName, holderID, l.TTL)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to obtain the lease on %s: %w", tableName, err)
+	}
+
+	held := newLease(holderID)
+	l.mu.Lock()
+	l.leases[tableName] = held
+	l.mu.Unlock()
+
+	interval := l.HeartbeatInterval
+	if l.db == nil {
+		interval = 0
+	}
+	go held.heartbeat(interval, func() (bool, error) {
+		return l.renew(ctx, tableName, holderID)
+	})
+	return nil
+}
+
+// Unlock implements the Locker interface by stopping the heartbeat and
+// deleting the lease row. It returns ErrLockLost if the lease expired and was
+// taken over by another process while it was held.
+func (l *LeaseLocker) Unlock(ctx context.Context, tx Queryer, tableName string) error {
+	l.mu.Lock()
+	held := l.leases[tableName]
+	delete(l.leases, tableName)
+	l.mu.Unlock()
+	if held == nil {
+		return nil
+	}
+
+	lost := held.stopHeartbeat()
+	released, err := l.table().release(ctx, tx, tableName, held.holderID)
+	if err == nil && (lost || !released) {
+		err = fmt.Errorf("%w: the lease on %s expired while it was held", ErrLockLost, tableName)
+	}
+	return err
+}
+
+// renew extends the lease on a connection of its own, since the locked
+// connection is busy running migrations
+func (l *LeaseLocker) renew(ctx context.Context, tableName, holderID string) (renewed bool, err error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { err = coalesceErrs(err, conn.Close()) }()
+	return l.table().renew(ctx, conn, tableName, holderID, l.TTL)
+}
+
+// LockStatus implements the LockInspector interface by reading the lease row
+func (l *LeaseLocker) LockStatus(ctx context.Context, tx Queryer, tableName string) (*LockStatus, error) {
+	return l.table().status(ctx, tx, tableName)
+}
+
+// KeyedLocker implements the LockKeyer interface. The returned Locker shares
+// this LeaseLocker's settings and leases, but names its leases after the
+// namespace as well as the tracking table.
+func (l *LeaseLocker) KeyedLocker(namespace string) Locker {
+	return keyedLeaseLocker{LeaseLocker: l, namespace: namespace}
+}
+
+func (l *LeaseLocker) table() leaseTable {
+	return newLeaseTable(l.dialect, l.TableName)
+}
+
+// keyedLeaseLocker is a LeaseLocker whose leases are placed in a namespace
+type keyedLeaseLocker struct {
+	*LeaseLocker
+	namespace string
+}
+
+func (k keyedLeaseLocker) Lock(ctx context.Context, tx Queryer, tableName string) error {
+	return k.LeaseLocker.Lock(ctx, tx, k.leaseName(tableName))
+}
+
+func (k keyedLeaseLocker) LockWithTimeout(ctx context.Context, tx Queryer, tableName string, timeout time.Duration) error {
+	return k.LeaseLocker.LockWithTimeout(ctx, tx, k.leaseName(tableName), timeout)
+}
+
+func (k keyedLeaseLocker) Unlock(ctx context.Context, tx Queryer, tableName string) error {
+	return k.LeaseLocker.Unlock(ctx, tx, k.leaseName(tableName))
+}
+
+func (k keyedLeaseLocker) LockStatus(ctx context.Context, tx Queryer, tableName string) (*LockStatus, error) {
+	return k.LeaseLocker.LockStatus(ctx, tx, k.leaseName(tableName))
+}
+
+func (k keyedLeaseLocker) leaseName(tableName string) string {
+	return namespacedLockName(k.namespace, tableName, leaseNameLength)
+}
+
+// leaseTable runs the queries behind table-based locks. Each row is the lease
+// on one tracking table, identified by its quoted name. Times are stored as
+// Unix milliseconds so that the same table definition works everywhere.
+type leaseTable struct {
+	dialect Dialect
+	name    string
+}
+
+func newLeaseTable(dialect Dialect, name string) leaseTable {
+	return leaseTable{dialect: dialect, name: dialect.QuotedTableName("", name)}
+}
+
+// create creates the lease table if it does not already exist
+func (t leaseTable) create(ctx context.Context, tx Queryer) error {
+	return createTableIfNotExists(ctx, tx, t.dialect, t.name, `(
+			lock_name VARCHAR(255) NOT NULL PRIMARY KEY,
+			holder_id VARCHAR(255) NOT NULL,
+			hostname VARCHAR(255) NOT NULL,
+			acquired_at BIGINT NOT NULL,
+			expires_at BIGINT NOT NULL
+		)`)
+}
+
+// tryAcquire makes a single attempt to obtain the lease on lockName for
+// holderID, first removing an expired lease held by anyone else.
+func (t leaseTable) tryAcquire(ctx context.Context, tx Queryer, lockName, holderID string, ttl time.Duration) (bool, error) {
+	// Another process may create the table at the same time, which some
+	// databases report as an error even with IF NOT EXISTS. That error only
+	// matters if the queries below fail too.
+	createErr := t.create(ctx, tx)
+
+	now := time.Now()
+	query := t.bind(fmt.Sprintf(`DELETE FROM %s WHERE lock_name = ? AND expires_at < ?`, t.name))
+	_, err := tx.ExecContext(ctx, query, lockName, now.UnixMilli())
+	if err != nil {
+		return false, coalesceErrs(createErr, err)
+	}
+
+	query = t.bind(fmt.Sprintf(`
+		INSERT INTO %s
+		( lock_name, holder_id, hostname, acquired_at, expires_at )
+		VALUES
+		( ?, ?, ?, ?, ? )
+		`, t.name,
+	))
+	_, insertErr := tx.ExecContext(ctx, query, lockName, holderID, localHostname, now.UnixMilli(), now.Add(ttl).UnixMilli())
+
+	// The INSERT fails when someone else holds the lease. Rather than
+	// interpreting each driver's duplicate key error, check who holds it.
+	current, err := t.holder(ctx, tx, lockName)
+	if err != nil {
+		return false, coalesceErrs(insertErr, err)
+	}
+	if current == "" {
+		return false, insertErr
+	}
+	return current == holderID, nil
+}
+
+// holder returns the ID of the current holder of the lease on lockName, or
+// an empty string if nobody holds it
+func (t leaseTable) holder(ctx context.Context, tx Queryer, lockName string) (string, error) {
+	var holderID string
+	query := t.bind(fmt.Sprintf(`SELECT holder_id FROM %s WHERE lock_name = ?`, t.name))
+	err := queryScalar(ctx, tx, &holderID, query, lockName)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return holderID, err
+}
+
+// status reports who holds the lease on lockName. An expired lease is
+// reported as not held.
+func (t leaseTable) status(ctx context.Context, tx Queryer, lockName string) (*LockStatus, error) {
+	err := t.create(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &LockStatus{}
+	var acquiredAt, expiresAt int64
+	query := t.bind(fmt.Sprintf(`SELECT holder_id, hostname, acquired_at, expires_at FROM %s WHERE lock_name = ?`, t.name))
+	found, err := queryRow(ctx, tx, query, []interface{}{lockName}, &status.Holder, &status.Host, &acquiredAt, &expiresAt)
+	if err != nil || !found {
+		return status, err
+	}
+	status.Since = time.UnixMilli(acquiredAt)
+	status.ExpiresAt = time.UnixMilli(expiresAt)
+	status.Held = status.ExpiresAt.After(time.Now())
+	return status, nil
+}
+
+// renew extends the lease on lockName, provided that holderID still holds it
+func (t leaseTable) renew(ctx context.Context, tx Queryer, lockName, holderID string, ttl time.Duration) (bool, error) {
+	query := t.bind(fmt.Sprintf(`UPDATE %s SET expires_at = ? WHERE lock_name = ? AND holder_id = ?`, t.name))
+	result, err := tx.ExecContext(ctx, query, time.Now().Add(ttl).UnixMilli(), lockName, holderID)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated == 1, err
+}
+
+// release deletes the lease on lockName, provided that holderID holds it. It
+// reports whether holderID still held the lease.
+func (t leaseTable) release(ctx context.Context, tx Queryer, lockName, holderID string) (bool, error) {
+	query := t.bind(fmt.Sprintf(`DELETE FROM %s WHERE lock_name = ? AND holder_id = ?`, t.name))
+	result, err := tx.ExecContext(ctx, query, lockName, holderID)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted == 1, err
+}
+
+// bind rewrites the ? placeholders in query into the form the Dialect's
+// driver expects
+func (t leaseTable) bind(query string) string {
+	return bindPlaceholders(t.dialect, query)
+}
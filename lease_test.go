@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Interface verification that LeaseLocker is a TimeoutLocker
+var (
+	_ Locker        = &LeaseLocker{}
+	_ TimeoutLocker = &LeaseLocker{}
+	_ LockInspector = &LeaseLocker{}
+	_ LockKeyer     = &LeaseLocker{}
+)
+
+func TestLeaseTableBind(t *testing.T) {
+	query := "UPDATE t SET a = ? WHERE b = ? AND c = ?"
+	tests := map[Dialect]string{
+		Postgres: "UPDATE t SET a = $1 WHERE b = $2 AND c = $3",
+		MSSQL:    "UPDATE t SET a = @p1 WHERE b = @p2 AND c = @p3",
+		MySQL:    query,
+		SQLite:   query,
+
+		// A Dialect embedding a built-in one inherits its placeholders, and
+		// one which hides them gets the default
+		struct{ postgresDialect }{}: "UPDATE t SET a = $1 WHERE b = $2 AND c = $3",
+		struct{ Dialect }{Postgres}: query,
+	}
+	for dialect, expected := range tests {
+		actual := newLeaseTable(dialect, DefaultLockTableName).bind(query)
+		if actual != expected {
+			t.Errorf("Expected %s, got %s", expected, actual)
+		}
+	}
+}
+
+func TestLeaseLocker(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		tableName := makeTestMigrator(WithDialect(tdb.Dialect)).QuotedTableName()
+		holder := NewLeaseLocker(db, tdb.Dialect)
+		waiter := NewLeaseLocker(db, tdb.Dialect)
+
+		err := holder.Lock(ctx, db, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = waiter.LockWithTimeout(ctx, db, tableName, 100*time.Millisecond)
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout while the lease is held. Got %v", err)
+		}
+		status, err := waiter.LockStatus(ctx, db, tableName)
+		if err != nil {
+			t.Error(err)
+		}
+		if !status.Held || status.Holder != holder.leases[tableName].holderID {
+			t.Errorf("Expected the holder's lease to be reported. Got %+v", status)
+		}
+
+		err = holder.Unlock(ctx, db, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = waiter.LockWithTimeout(ctx, db, tableName, 100*time.Millisecond)
+		if err != nil {
+			t.Errorf("Expected the released lease to be obtained. Got %v", err)
+		}
+		_ = waiter.Unlock(ctx, db, tableName)
+	})
+}
+
+func TestLeaseLockerHeartbeat(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		tableName := makeTestMigrator(WithDialect(SQLite)).QuotedTableName()
+		holder := NewLeaseLocker(db, SQLite)
+		holder.TTL = 200 * time.Millisecond
+		holder.HeartbeatInterval = 20 * time.Millisecond
+
+		err := holder.Lock(ctx, db, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(3 * holder.TTL)
+
+		err = NewLeaseLocker(db, SQLite).LockWithTimeout(ctx, db, tableName, 0)
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected the heartbeat to keep the lease alive. Got %v", err)
+		}
+		err = holder.Unlock(ctx, db, tableName)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestLeaseLockerTakesOverStaleLease(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		tableName := makeTestMigrator(WithDialect(SQLite)).QuotedTableName()
+		stale := NewLeaseLocker(db, SQLite)
+		stale.TTL = 50 * time.Millisecond
+		stale.HeartbeatInterval = 200 * time.Millisecond
+
+		err := stale.Lock(ctx, db, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * stale.TTL)
+
+		successor := NewLeaseLocker(db, SQLite)
+		err = successor.LockWithTimeout(ctx, db, tableName, 0)
+		if err != nil {
+			t.Fatalf("Expected the stale lease to be taken over. Got %v", err)
+		}
+
+		// Give the stale holder's heartbeat a chance to notice
+		time.Sleep(2 * stale.HeartbeatInterval)
+		err = stale.Unlock(ctx, db, tableName)
+		if !errors.Is(err, ErrLockLost) {
+			t.Errorf("Expected ErrLockLost. Got %v", err)
+		}
+
+		err = NewLeaseLocker(db, SQLite).LockWithTimeout(ctx, db, tableName, 0)
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected the successor to still hold the lease. Got %v", err)
+		}
+		_ = successor.Unlock(ctx, db, tableName)
+	})
+}
+
+func TestApplyWithLeaseLocker(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithLocker(NewLeaseLocker(db, tdb.Dialect)))
+		err := migrator.Apply(db, testMigrations(t, "useless-ansi"))
+		if err != nil {
+			t.Error(err)
+		}
+
+		holderID, err := newLeaseTable(tdb.Dialect, DefaultLockTableName).holder(context.Background(), db, migrator.QuotedTableName())
+		if err != nil {
+			t.Error(err)
+		}
+		if holderID != "" {
+			t.Errorf("Expected the lease to be released. Held by %s", holderID)
+		}
+	})
+}
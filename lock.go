@@ -0,0 +1,240 @@
+package schema
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"time"
+)
+
+const (
+	// lockPollInterval is the initial wait between attempts by dialects which
+	// poll for their lock
+	lockPollInterval = 50 * time.Millisecond
+
+	// maxLockPollInterval caps the wait between polling attempts
+	maxLockPollInterval = time.Second
+
+	// defaultLockRetryTimeout limits each attempt to obtain the lock when
+	// WithLockRetry is used without WithLockTimeout, so that attempts on
+	// dialects which would otherwise wait indefinitely can be retried
+	defaultLockRetryTimeout = 30 * time.Second
+)
+
+// lockWaitNoticeKey is the Context key of the function which pollLock calls
+// when its first attempt finds the lock held, so that the Migrator can log
+// that it is waiting
+type lockWaitNoticeKey struct{}
+
+// LockStatus describes the current holder of the lock on a tracking table.
+// Fields other than Held are left empty when the database doesn't expose
+// them to the inspecting user.
+type LockStatus struct {
+	// Held reports whether any session currently holds the lock
+	Held bool
+
+	// Holder identifies the session holding the lock: the backend PID on
+	// PostgreSQL, the connection ID on MySQL, the session ID on SQL Server,
+	// or the holder ID of a table-based lock
+	Holder string
+
+	// Host is the holder's client host or address
+	Host string
+
+	// User is the database user of the holder's session
+	User string
+
+	// Since is when the holder's session started or, for table-based locks,
+	// when the lock was acquired
+	Since time.Time
+
+	// ExpiresAt is when a table-based lock expires unless it is renewed
+	ExpiresAt time.Time
+}
+
+// LockStatus reports whether the lock which Apply takes on the tracking
+// table is currently held and, where the database exposes it, by which
+// session. It doesn't take the lock itself, so it can be used to diagnose a
+// deploy which is stuck waiting for it.
+func (m *Migrator) LockStatus(db DB) (status *LockStatus, err error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	l, err := m.resolveLocker()
+	if err != nil {
+		return nil, err
+	}
+	inspector, isInspector := l.(LockInspector)
+	if !isInspector {
+		return nil, fmt.Errorf("%T can't report the status of its lock: %w", l, errors.ErrUnsupported)
+	}
+
+	conn, err := db.Conn(m.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = coalesceErrs(err, conn.Close()) }()
+
+	return inspector.LockStatus(m.ctx, conn, m.QuotedTableName())
+}
+
+// localHostname identifies this machine in the lock rows of table-based locks
+// and in extended tracking records
+var localHostname, _ = os.Hostname()
+
+// newLockHolderID builds a unique identifier for a table-based lock holder
+func newLockHolderID() string {
+	nonce := make([]byte, 4)
+	_, _ = rand.Read(nonce)
+	return fmt.Sprintf("%s:%d:%x", localHostname, os.Getpid(), nonce)
+}
+
+// lock obtains the Dialect's lock on the tracking table, if it is a Locker.
+// An attempt which fails with ErrLockTimeout is retried as configured by
+// WithLockRetry.
+func (m *Migrator) lock(tx Queryer) error {
+	l, err := m.resolveLocker()
+	if l == nil || err != nil {
+		return err
+	}
+
+	backoff := m.lockBackoff
+	for attempt := 1; ; attempt++ {
+		err := m.tryLock(l, tx)
+		if err == nil {
+			m.log(fmt.Sprintf("Locked %s at %s", m.QuotedTableName(), time.Now().Format(time.RFC3339Nano)))
+			return nil
+		}
+		if !errors.Is(err, ErrLockTimeout) {
+			return err
+		}
+		if attempt > m.lockRetries {
+			return fmt.Errorf("giving up on locking %s after %d attempt(s): %w", m.QuotedTableName(), attempt, err)
+		}
+
+		m.log(fmt.Sprintf("Waiting for lock on %s held by another process. Retrying in %s", m.QuotedTableName(), backoff))
+		err = sleepContext(m.ctx, backoff)
+		if err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// resolveLocker returns the Locker configured by WithLocker, falling back to
+// the Dialect when it is a Locker, and places it in the namespace configured
+// by WithLockKey. It returns nil when there is no Locker.
+func (m *Migrator) resolveLocker() (Locker, error) {
+	l := m.locker
+	if l == nil {
+		dl, isLocker := m.Dialect.(Locker)
+		if !isLocker {
+			return nil, nil
+		}
+		l = dl
+	}
+	if m.lockKey == "" {
+		return l, nil
+	}
+	keyer, isKeyer := l.(LockKeyer)
+	if !isKeyer {
+		return nil, fmt.Errorf("%T doesn't support WithLockKey: %w", l, errors.ErrUnsupported)
+	}
+	return keyer.KeyedLocker(m.lockKey), nil
+}
+
+// tryLock makes a single attempt to obtain the lock, honoring the timeout
+// configured by WithLockTimeout when the Locker supports it. Attempts which
+// will be retried are limited to defaultLockRetryTimeout when no timeout was
+// configured.
+func (m *Migrator) tryLock(l Locker, tx Queryer) error {
+	ctx := context.WithValue(m.ctx, lockWaitNoticeKey{}, func() {
+		m.log(fmt.Sprintf("Waiting for lock on %s held by another process", m.QuotedTableName()))
+	})
+	timeout := m.lockTimeout
+	if timeout == 0 && m.lockRetries > 0 {
+		timeout = defaultLockRetryTimeout
+	}
+	if tl, isTimeoutLocker := l.(TimeoutLocker); isTimeoutLocker && timeout > 0 {
+		return tl.LockWithTimeout(ctx, tx, m.QuotedTableName(), timeout)
+	}
+	return l.Lock(ctx, tx, m.QuotedTableName())
+}
+
+func (m *Migrator) unlock(tx Queryer) error {
+	l, err := m.resolveLocker()
+	if l == nil || err != nil {
+		return err
+	}
+	err = l.Unlock(m.ctx, tx, m.QuotedTableName())
+	if err != nil {
+		return err
+	}
+	m.log(fmt.Sprintf("Unlocked %s at %s", m.QuotedTableName(), time.Now().Format(time.RFC3339Nano)))
+	return nil
+}
+
+// namespacedLockName combines a WithLockKey namespace with the name of the
+// tracking table for Lockers which identify locks by name. Names longer than
+// maxLength characters are shortened, keeping them unique with a checksum of
+// the full name.
+func namespacedLockName(namespace, tableName string, maxLength int) string {
+	name := []rune(namespace + ":" + tableName)
+	if len(name) <= maxLength {
+		return string(name)
+	}
+	sum := crc32.ChecksumIEEE([]byte(string(name)))
+	return fmt.Sprintf("%s:%08x", string(name[:maxLength-9]), sum)
+}
+
+// pollLock calls tryLock until it reports that the lock was obtained or the
+// timeout expires, waiting between attempts with an exponential backoff. It
+// returns ErrLockTimeout if the timeout expires. A negative timeout waits
+// indefinitely. When the first attempt finds the lock held, the wait notice
+// in the Context (if any) is called.
+func pollLock(ctx context.Context, timeout time.Duration, tryLock func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	interval := lockPollInterval
+	for attempt := 1; ; attempt++ {
+		acquired, err := tryLock()
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+		if notice, hasNotice := ctx.Value(lockWaitNoticeKey{}).(func()); hasNotice && attempt == 1 {
+			notice()
+		}
+
+		wait := interval
+		if timeout >= 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return ErrLockTimeout
+			}
+			wait = min(wait, remaining)
+		}
+		err = sleepContext(ctx, wait)
+		if err != nil {
+			return err
+		}
+		interval = min(interval*2, maxLockPollInterval)
+	}
+}
+
+// sleepContext pauses for the supplied duration, returning early with the
+// Context's error if it is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,277 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyLockDialect is a Locker whose lock attempts time out a fixed number of
+// times before succeeding
+type flakyLockDialect struct {
+	Dialect
+	timeouts    int
+	attempts    int
+	lastTimeout time.Duration
+}
+
+func (d *flakyLockDialect) Lock(ctx context.Context, tx Queryer, tableName string) error {
+	return d.LockWithTimeout(ctx, tx, tableName, 0)
+}
+
+func (d *flakyLockDialect) LockWithTimeout(ctx context.Context, tx Queryer, tableName string, timeout time.Duration) error {
+	d.attempts++
+	d.lastTimeout = timeout
+	if d.attempts <= d.timeouts {
+		return ErrLockTimeout
+	}
+	return nil
+}
+
+func (d *flakyLockDialect) Unlock(ctx context.Context, tx Queryer, tableName string) error {
+	return nil
+}
+
+func TestLockRetry(t *testing.T) {
+	t.Run("Succeeds", func(t *testing.T) {
+		var lines LogLines
+		dialect := &flakyLockDialect{Dialect: Postgres, timeouts: 2}
+		migrator := NewMigrator(WithDialect(dialect), WithLockRetry(2, time.Millisecond), WithLogger(&lines))
+		err := migrator.lock(BadQueryer{})
+		if err != nil {
+			t.Error(err)
+		}
+		if dialect.attempts != 3 {
+			t.Errorf("Expected 3 attempts. Got %d", dialect.attempts)
+		}
+		if !lines.Contains("held by another process") {
+			t.Errorf("Expected a waiting message. Got %v", lines)
+		}
+	})
+
+	t.Run("DefaultTimeout", func(t *testing.T) {
+		dialect := &flakyLockDialect{Dialect: Postgres}
+		migrator := NewMigrator(WithDialect(dialect), WithLockRetry(1, time.Millisecond))
+		err := migrator.lock(BadQueryer{})
+		if err != nil {
+			t.Error(err)
+		}
+		if dialect.lastTimeout != defaultLockRetryTimeout {
+			t.Errorf("Expected attempts to be limited to %s. Got %s", defaultLockRetryTimeout, dialect.lastTimeout)
+		}
+
+		migrator = NewMigrator(WithDialect(dialect), WithLockRetry(1, time.Millisecond), WithLockTimeout(time.Second))
+		err = migrator.lock(BadQueryer{})
+		if err != nil {
+			t.Error(err)
+		}
+		if dialect.lastTimeout != time.Second {
+			t.Errorf("Expected the configured timeout. Got %s", dialect.lastTimeout)
+		}
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		dialect := &flakyLockDialect{Dialect: Postgres, timeouts: 5}
+		migrator := NewMigrator(WithDialect(dialect), WithLockRetry(1, time.Millisecond))
+		err := migrator.lock(BadQueryer{})
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout. Got %v", err)
+		}
+		if dialect.attempts != 2 {
+			t.Errorf("Expected 2 attempts. Got %d", dialect.attempts)
+		}
+	})
+
+	t.Run("NoRetries", func(t *testing.T) {
+		dialect := &flakyLockDialect{Dialect: Postgres, timeouts: 1}
+		migrator := NewMigrator(WithDialect(dialect))
+		err := migrator.lock(BadQueryer{})
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout. Got %v", err)
+		}
+		if dialect.attempts != 1 {
+			t.Errorf("Expected 1 attempt. Got %d", dialect.attempts)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		dialect := &flakyLockDialect{Dialect: Postgres, timeouts: 1}
+		migrator := NewMigrator(WithDialect(dialect), WithContext(ctx), WithLockRetry(1, time.Hour))
+		err := migrator.lock(BadQueryer{})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled. Got %v", err)
+		}
+	})
+}
+
+func TestPollLock(t *testing.T) {
+	t.Run("Acquired", func(t *testing.T) {
+		attempts := 0
+		err := pollLock(context.Background(), time.Second, func() (bool, error) {
+			attempts++
+			return attempts == 2, nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if attempts != 2 {
+			t.Errorf("Expected 2 attempts. Got %d", attempts)
+		}
+	})
+
+	t.Run("NoticesWaiting", func(t *testing.T) {
+		notices := 0
+		ctx := context.WithValue(context.Background(), lockWaitNoticeKey{}, func() { notices++ })
+		attempts := 0
+		err := pollLock(ctx, time.Second, func() (bool, error) {
+			attempts++
+			return attempts == 3, nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if notices != 1 {
+			t.Errorf("Expected 1 notice. Got %d", notices)
+		}
+	})
+
+	t.Run("TimedOut", func(t *testing.T) {
+		err := pollLock(context.Background(), 10*time.Millisecond, func() (bool, error) {
+			return false, nil
+		})
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout. Got %v", err)
+		}
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		err := pollLock(context.Background(), time.Second, func() (bool, error) {
+			return false, ErrLockFailed
+		})
+		if !errors.Is(err, ErrLockFailed) {
+			t.Errorf("Expected ErrLockFailed. Got %v", err)
+		}
+	})
+}
+
+func TestLockStatusWithNilDB(t *testing.T) {
+	_, err := NewMigrator().LockStatus(nil)
+	if !errors.Is(err, ErrNilDB) {
+		t.Errorf("Expected %v, got %v", ErrNilDB, err)
+	}
+}
+
+func TestLockStatusUnsupported(t *testing.T) {
+	migrator := NewMigrator(WithDialect(&flakyLockDialect{Dialect: Postgres}))
+	_, err := migrator.LockStatus(BadDB{})
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected errors.ErrUnsupported. Got %v", err)
+	}
+}
+
+func TestNamespacedLockName(t *testing.T) {
+	name := namespacedLockName("billing", `"schema_migrations"`, 64)
+	if name != `billing:"schema_migrations"` {
+		t.Errorf("Unexpected lock name %s", name)
+	}
+
+	long := strings.Repeat("n", 100)
+	name = namespacedLockName(long, "a", 64)
+	if len(name) != 64 || !strings.HasPrefix(name, "nnnn") {
+		t.Errorf("Expected a 64 character name. Got %s", name)
+	}
+	if name == namespacedLockName(long, "b", 64) {
+		t.Errorf("Expected shortened names to remain unique")
+	}
+}
+
+// TestWithLockKey ensures that Migrators with different lock keys don't
+// exclude each other, while those sharing a key do
+func TestWithLockKey(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		tableName := fmt.Sprintf("lock_key_%d", time.Now().UnixNano())
+		billing := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName), WithLockKey("billing"), WithLockTimeout(time.Second))
+		shipping := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName), WithLockKey("shipping"), WithLockTimeout(time.Second))
+
+		conns := make([]*sql.Conn, 3)
+		for i := range conns {
+			conn, err := db.Conn(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = conn.Close() }()
+			conns[i] = conn
+		}
+
+		err := billing.lock(conns[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = billing.unlock(conns[0]) }()
+
+		err = shipping.lock(conns[1])
+		if err != nil {
+			t.Errorf("Expected a different lock key not to be blocked. Got %v", err)
+		}
+		_ = shipping.unlock(conns[1])
+
+		err = billing.lock(conns[2])
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout for the same lock key. Got %v", err)
+		}
+
+		status, err := billing.LockStatus(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Held {
+			t.Errorf("Expected the billing lock to be reported as held")
+		}
+		status, err = shipping.LockStatus(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Held {
+			t.Errorf("Expected the shipping lock to be reported as free. Got %+v", status)
+		}
+	})
+}
+
+// TestLockLogsWhileWaiting ensures that operators can see why a deploy is
+// stalled while a dialect polls for its lock
+func TestLockLogsWhileWaiting(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		var lines LogLines
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithLockTimeout(100*time.Millisecond), WithLogger(&lines))
+		holder, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = holder.Close() }()
+		err = SQLite.Lock(context.Background(), holder, migrator.QuotedTableName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = SQLite.Unlock(context.Background(), holder, migrator.QuotedTableName()) }()
+
+		err = migrator.Apply(db, testMigrations(t, "useless-ansi"))
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout. Got %v", err)
+		}
+		if !lines.Contains("Waiting for lock on " + migrator.QuotedTableName() + " held by another process") {
+			t.Errorf("Expected a waiting message. Got %v", lines)
+		}
+	})
+}
@@ -1,22 +1,87 @@
 package schema
 
 import (
-	"crypto/md5" // #nosec MD5 only being used to fingerprint script contents, not for encryption
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 )
 
+// NoTransactionDirective is a magic comment which, when it appears on its own
+// line in a migration's Script, has the same effect as setting the
+// Migration's NoTransaction field.
+const NoTransactionDirective = "-- schema:no-transaction"
+
 // Migration is a yet-to-be-run change to the schema. This is the type which
 // is provided to Migrator.Apply to request a schema change.
 type Migration struct {
 	ID     string
 	Script string
+
+	// NoTransaction causes the Script to be run directly on the locked
+	// connection instead of inside a transaction. This is required for
+	// statements which databases refuse to run in a transaction, such as
+	// Postgres' CREATE INDEX CONCURRENTLY. If a non-transactional Script
+	// fails partway through, its earlier statements are not rolled back.
+	NoTransaction bool
+}
+
+// MigrationError is returned when a Migration's Script fails to run. It can
+// be extracted from the error returned by Apply with errors.As, and it wraps
+// the error reported by the database driver.
+type MigrationError struct {
+	Migration *Migration
+
+	// Statement is the text of the failing statement. It is the entire
+	// Script when the Dialect doesn't split scripts into statements.
+	Statement string
+
+	// StatementIndex is the 0-based position of the failing statement among
+	// the StatementCount statements of the Script
+	StatementIndex int
+	StatementCount int
+
+	// Offset is the byte offset of the failing statement within the Script
+	Offset int
+
+	// Elapsed is the time spent running the Script before it failed
+	Elapsed time.Duration
+
+	// Err is the error reported by the database driver, or the error which
+	// kept the Script from being split into statements
+	Err error
+}
+
+func (e *MigrationError) Error() string {
+	if e.StatementCount > 1 {
+		return fmt.Sprintf("Migration '%s' Failed on statement %d of %d:\n%s\n%s", e.Migration.ID, e.StatementIndex+1, e.StatementCount, e.Statement, e.Err)
+	}
+	return fmt.Sprintf("Migration '%s' Failed:\n%s", e.Migration.ID, e.Err)
+}
+
+// Unwrap returns Err
+func (e *MigrationError) Unwrap() error {
+	return e.Err
 }
 
 // MD5 computes the MD5 hash of the Script for this migration so that it
 // can be uniquely identified later.
 func (m *Migration) MD5() string {
-	return fmt.Sprintf("%x", md5.Sum([]byte(m.Script))) // #nosec not being used cryptographically
+	return MD5Checksum.Sum(m.Script)
+}
+
+// transactional reports whether the migration should be run inside a
+// transaction, based on its NoTransaction field and NoTransactionDirective.
+func (m *Migration) transactional() bool {
+	if m.NoTransaction {
+		return false
+	}
+	for _, line := range strings.Split(m.Script, "\n") {
+		if strings.EqualFold(strings.TrimSpace(line), NoTransactionDirective) {
+			return false
+		}
+	}
+	return true
 }
 
 // SortMigrations sorts a slice of migrations by their IDs
@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"errors"
 	"regexp"
 	"testing"
 )
@@ -13,6 +14,26 @@ func TestMD5(t *testing.T) {
 	}
 }
 
+func TestMigrationTransactional(t *testing.T) {
+	table := map[string]struct {
+		migration Migration
+		expected  bool
+	}{
+		"Default":           {Migration{Script: "CREATE INDEX idx ON users (name)"}, true},
+		"Field":             {Migration{Script: "CREATE INDEX idx ON users (name)", NoTransaction: true}, false},
+		"Directive":         {Migration{Script: "-- schema:no-transaction\nCREATE INDEX CONCURRENTLY idx ON users (name)"}, false},
+		"Indented":          {Migration{Script: "  -- SCHEMA:NO-TRANSACTION  \r\nCREATE INDEX CONCURRENTLY idx ON users (name)"}, false},
+		"Directive In Text": {Migration{Script: "SELECT '-- schema:no-transaction'"}, true},
+	}
+	for name, test := range table {
+		t.Run(name, func(t *testing.T) {
+			if actual := test.migration.transactional(); actual != test.expected {
+				t.Errorf("Expected transactional() to be %t. Got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
 func TestSortMigrations(t *testing.T) {
 	migrations := []*Migration{
 		{ID: "2020-01-01"},
@@ -66,3 +87,19 @@ func expectScriptMatch(t *testing.T, migration *Migration, regexpString string)
 		t.Errorf("Expected migration Script to match '%s', but it did not. Script was:\n%s", regexpString, migration.Script)
 	}
 }
+
+func TestMigrationError(t *testing.T) {
+	driverErr := errors.New("syntax error")
+	migration := &Migration{ID: "2021-01-01 Broken", Script: "SELECT 1;\nSELEC 2;"}
+
+	err := error(&MigrationError{Migration: migration, Statement: migration.Script, StatementCount: 1, Err: driverErr})
+	if err.Error() != "Migration '2021-01-01 Broken' Failed:\nsyntax error" {
+		t.Errorf("Unexpected message: %s", err)
+	}
+	if !errors.Is(err, driverErr) {
+		t.Error("Expected MigrationError to wrap the driver error")
+	}
+
+	err = &MigrationError{Migration: migration, Statement: "SELEC 2", StatementIndex: 1, StatementCount: 2, Offset: 10, Err: driverErr}
+	expectErrorContains(t, err, "Failed on statement 2 of 2:\nSELEC 2\nsyntax error")
+}
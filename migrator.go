@@ -15,16 +15,31 @@ type Migrator struct {
 	Dialect    Dialect
 	Logger     Logger
 
-	ctx context.Context
+	ctx                  context.Context
+	unknownAppliedPolicy Policy
+	outOfOrderPolicy     Policy
+	transactionMode      TransactionMode
+	lockTimeout          time.Duration
+	lockRetries          int
+	lockBackoff          time.Duration
+	locker               Locker
+	lockKey              string
+	extendedTracking     bool
+	appVersion           string
+	history              bool
+	attempts             []*MigrationAttempt
+	checksummer          ChecksumAlgorithm
+	checksumRewrite      bool
 }
 
 // NewMigrator creates a new Migrator with the supplied
 // options
 func NewMigrator(options ...Option) *Migrator {
 	m := Migrator{
-		TableName: DefaultTableName,
-		Dialect:   Postgres,
-		ctx:       context.Background(),
+		TableName:            DefaultTableName,
+		Dialect:              Postgres,
+		ctx:                  context.Background(),
+		unknownAppliedPolicy: PolicyWarn,
 	}
 	for _, opt := range options {
 		m = opt(m)
@@ -39,7 +54,10 @@ func (m *Migrator) QuotedTableName() string {
 }
 
 // Apply takes a slice of Migrations and applies any which have not yet
-// been applied against the provided database. Apply can be re-called
+// been applied against the provided database. By default, all of the
+// pending migrations are applied in a single transaction; see
+// WithTransactionMode for alternatives and Migration.NoTransaction for
+// migrations which can't run in a transaction. Apply can be re-called
 // sequentially with the same Migrations and different databases, but it is
 // not threadsafe... if concurrent applies are desired, multiple Migrators
 // should be used.
@@ -53,12 +71,61 @@ func (m *Migrator) Apply(db DB, migrations []*Migration) (err error) {
 		return nil
 	}
 
+	if m.transactionMode == PerMigration || !allTransactional(migrations) {
+		return m.withLock(db, func(conn Connection) error {
+			return m.runInBatches(conn, migrations)
+		})
+	}
+
+	return m.inLockedTx(db, func(tx Queryer) error {
+		return m.run(tx, migrations)
+	})
+}
+
+// Plan returns the Migrations which Apply would run against the provided
+// database, in the order it would run them, without executing any of them.
+// Plan takes the same lock and creates the tracking table if necessary, so
+// the same Policies are enforced as with Apply.
+func (m *Migrator) Plan(db DB, migrations []*Migration) (plan []*Migration, err error) {
+	plan = make([]*Migration, 0)
+	if db == nil {
+		return plan, ErrNilDB
+	}
+
+	if len(migrations) == 0 {
+		return plan, nil
+	}
+
+	err = m.inLockedTx(db, func(tx Queryer) error {
+		plan, err = m.computeMigrationPlan(tx, migrations)
+		return err
+	})
+	return plan, err
+}
+
+// inLockedTx holds the Migrator's lock and runs f inside a transaction in
+// which the tracking table is guaranteed to exist.
+func (m *Migrator) inLockedTx(db DB, f func(tx Queryer) error) error {
+	return m.withLock(db, func(conn Connection) error {
+		return m.inTx(conn, func(tx Queryer) error {
+			err := m.createMigrationsTable(tx)
+			if err != nil {
+				return err
+			}
+			return f(tx)
+		})
+	})
+}
+
+// withLock obtains a dedicated connection to the database and holds the
+// Migrator's lock on it (if the Dialect supports locking) while f runs.
+func (m *Migrator) withLock(db DB, f func(conn Connection) error) (err error) {
 	if m.ctx == nil {
 		m.ctx = context.Background()
 	}
 
 	// Obtain a concrete connection to the database which will be closed
-	// at the conclusion of Apply()
+	// at the conclusion of the operation
 	conn, err := db.Conn(m.ctx)
 	if err != nil {
 		return err
@@ -74,50 +141,35 @@ func (m *Migrator) Apply(db DB, migrations []*Migration) (err error) {
 	}
 	defer func() { err = coalesceErrs(err, m.unlock(conn)) }()
 
+	// Attempts are recorded once all transactions have ended, so that the
+	// attempts of failed migrations aren't rolled back with them
+	err = f(conn)
+	return coalesceErrs(err, m.writeAttempts(conn))
+}
+
+// inTx runs f inside a new transaction on conn. The transaction is committed
+// if f succeeds, and rolled back otherwise.
+func (m *Migrator) inTx(conn Transactor, f func(tx Queryer) error) error {
 	tx, err := conn.BeginTx(m.ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	err = m.Dialect.CreateMigrationsTable(m.ctx, tx, m.QuotedTableName())
+	firstAttempt := len(m.attempts)
+	err = f(tx)
 	if err != nil {
 		_ = tx.Rollback()
+		m.rollBackAttempts(firstAttempt)
 		return err
 	}
 
-	err = m.run(tx, migrations)
+	err = tx.Commit()
 	if err != nil {
-		_ = tx.Rollback()
-		return err
+		m.rollBackAttempts(firstAttempt)
 	}
-
-	err = tx.Commit()
-
 	return err
 }
 
-func (m *Migrator) lock(tx Queryer) error {
-	if l, isLocker := m.Dialect.(Locker); isLocker {
-		err := l.Lock(m.ctx, tx, m.QuotedTableName())
-		if err != nil {
-			return err
-		}
-		m.log(fmt.Sprintf("Locked %s at %s", m.QuotedTableName(), time.Now().Format(time.RFC3339Nano)))
-	}
-	return nil
-}
-
-func (m *Migrator) unlock(tx Queryer) error {
-	if l, isLocker := m.Dialect.(Locker); isLocker {
-		err := l.Unlock(m.ctx, tx, m.QuotedTableName())
-		if err != nil {
-			return err
-		}
-		m.log(fmt.Sprintf("Unlocked %s at %s", m.QuotedTableName(), time.Now().Format(time.RFC3339Nano)))
-	}
-	return nil
-}
-
 func (m *Migrator) computeMigrationPlan(tx Queryer, toRun []*Migration) (plan []*Migration, err error) {
 	applied, err := m.GetAppliedMigrations(tx)
 	if err != nil {
@@ -132,9 +184,37 @@ func (m *Migrator) computeMigrationPlan(tx Queryer, toRun []*Migration) (plan []
 	}
 
 	SortMigrations(plan)
+
+	if ids := unknownAppliedIDs(applied, toRun); len(ids) > 0 {
+		err = m.enforce(m.unknownAppliedPolicy, &UnknownMigrationsError{IDs: ids})
+		if err != nil {
+			return plan, err
+		}
+	}
+
+	latestID := latestAppliedID(applied)
+	for _, migration := range plan {
+		if migration.ID < latestID {
+			err = m.enforce(m.outOfOrderPolicy, &OutOfOrderError{Migration: migration, LatestAppliedID: latestID})
+			if err != nil {
+				return plan, err
+			}
+		}
+	}
 	return plan, err
 }
 
+// latestAppliedID returns the ID which sorts last among the applied
+// migrations, or an empty string if none have been applied
+func latestAppliedID(applied map[string]*AppliedMigration) (latest string) {
+	for id := range applied {
+		if id > latest {
+			latest = id
+		}
+	}
+	return latest
+}
+
 func (m *Migrator) run(tx Queryer, migrations []*Migration) error {
 	if tx == nil {
 		return ErrNilDB
@@ -144,6 +224,10 @@ func (m *Migrator) run(tx Queryer, migrations []*Migration) error {
 	if err != nil {
 		return err
 	}
+	err = m.rewriteChecksums(tx, migrations)
+	if err != nil {
+		return err
+	}
 
 	for _, migration := range plan {
 		err = m.runMigration(tx, migration)
@@ -155,11 +239,98 @@ func (m *Migrator) run(tx Queryer, migrations []*Migration) error {
 	return nil
 }
 
-func (m *Migrator) runMigration(tx Queryer, migration *Migration) error {
+// runInBatches computes the migration plan in its own transaction, and then
+// applies it in a series of batches which are each committed before the next
+// begins. Consecutive transactional migrations share a batch in AllInOne
+// mode, and each get their own in PerMigration mode. Non-transactional
+// migrations run directly on conn between batches.
+func (m *Migrator) runInBatches(conn Connection, migrations []*Migration) error {
+	var plan []*Migration
+	err := m.inTx(conn, func(tx Queryer) (err error) {
+		err = m.createMigrationsTable(tx)
+		if err != nil {
+			return err
+		}
+		plan, err = m.computeMigrationPlan(tx, migrations)
+		if err != nil {
+			return err
+		}
+		return m.rewriteChecksums(tx, migrations)
+	})
+	if err != nil {
+		return err
+	}
+
+	batch := make([]*Migration, 0)
+	for _, migration := range plan {
+		switch {
+		case !migration.transactional():
+			err = m.runBatch(conn, batch)
+			batch = batch[:0]
+			if err == nil {
+				err = m.runMigration(conn, migration)
+			}
+		case m.transactionMode == PerMigration:
+			err = m.runBatch(conn, []*Migration{migration})
+		default:
+			batch = append(batch, migration)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.runBatch(conn, batch)
+}
+
+// runBatch applies the supplied migrations in a single transaction
+func (m *Migrator) runBatch(conn Connection, batch []*Migration) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	return m.inTx(conn, func(tx Queryer) error {
+		for _, migration := range batch {
+			err := m.runMigration(tx, migration)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// allTransactional reports whether every supplied migration can be run
+// inside a transaction
+func allTransactional(migrations []*Migration) bool {
+	for _, migration := range migrations {
+		if !migration.transactional() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Migrator) runMigration(tx Queryer, migration *Migration) (err error) {
 	startedAt := time.Now()
-	_, err := tx.ExecContext(m.ctx, migration.Script)
+	defer func() { m.recordAttempt(migration, startedAt, err) }()
+
+	statements, err := m.statements(migration)
 	if err != nil {
-		return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+		return &MigrationError{Migration: migration, Err: err}
+	}
+	for i, statement := range statements {
+		_, err = tx.ExecContext(m.ctx, statement.SQL)
+		if err != nil {
+			return &MigrationError{
+				Migration:      migration,
+				Statement:      statement.SQL,
+				StatementIndex: i,
+				StatementCount: len(statements),
+				Offset:         statement.Offset,
+				Elapsed:        time.Since(startedAt),
+				Err:            err,
+			}
+		}
 	}
 
 	executionTime := time.Since(startedAt)
@@ -174,9 +345,35 @@ func (m *Migrator) runMigration(tx Queryer, migration *Migration) error {
 	applied := AppliedMigration{}
 	applied.ID = migration.ID
 	applied.Script = migration.Script
+	applied.Checksum = m.checksum(migration)
 	applied.ExecutionTimeInMillis = ms
 	applied.AppliedAt = startedAt
-	return m.Dialect.InsertAppliedMigration(m.ctx, tx, m.QuotedTableName(), &applied)
+	applied.AppliedBy = localUsername
+	applied.Hostname = localHostname
+	applied.AppVersion = m.appVersion
+	return m.insertAppliedMigration(tx, &applied)
+}
+
+// statements returns the statements of the supplied migration's Script, split
+// by the Dialect when it is a StatementSplitter
+func (m *Migrator) statements(migration *Migration) ([]Statement, error) {
+	splitter, isSplitter := m.Dialect.(StatementSplitter)
+	if !isSplitter {
+		return []Statement{{SQL: migration.Script}}, nil
+	}
+	return splitter.SplitStatements(migration.Script)
+}
+
+// enforce reacts to a detected problem according to the supplied Policy. It
+// returns problem only when the Policy is PolicyFail.
+func (m *Migrator) enforce(policy Policy, problem error) error {
+	switch policy {
+	case PolicyFail:
+		return problem
+	case PolicyWarn:
+		m.log(fmt.Sprintf("WARNING: %s", problem))
+	}
+	return nil
 }
 
 func (m *Migrator) log(msgs ...interface{}) {
@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -113,6 +114,48 @@ func TestApplyInLexicalOrder(t *testing.T) {
 	})
 }
 
+// TestPlan ensures that Plan reports pending migrations in the order they
+// would run, without running them.
+func TestPlan(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		migrations := testMigrations(t, "useless-ansi")
+		plan, err := migrator.Plan(db, []*Migration{migrations[1], migrations[0]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan) != 2 {
+			t.Fatalf("Expected 2 planned migrations. Got %d", len(plan))
+		}
+		expectID(t, plan[0], migrations[0].ID)
+		expectID(t, plan[1], migrations[1].ID)
+
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(applied) != 0 {
+			t.Errorf("Expected Plan not to apply anything. Got %d applied migrations", len(applied))
+		}
+
+		err = migrator.Apply(db, migrations[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err = migrator.Plan(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan) != 1 {
+			t.Fatalf("Expected 1 planned migration. Got %d", len(plan))
+		}
+		expectID(t, plan[0], migrations[1].ID)
+	})
+}
+
 // TestFailedMigration ensures that a migration with a syntax error triggers
 // an expected error when Apply() is run. This test is run on every dialect
 // and every test database instance
@@ -133,6 +176,17 @@ func TestFailedMigration(t *testing.T) {
 		err := migrator.Apply(db, migrations)
 		expectErrorContains(t, err, "TIBBLE")
 
+		var migrationErr *MigrationError
+		if !errors.As(err, &migrationErr) {
+			t.Fatalf("Expected a *MigrationError. Got %v", err)
+		}
+		if migrationErr.Migration != migrations[0] || migrationErr.Statement != migrations[0].Script {
+			t.Errorf("Unexpected MigrationError details: %+v", migrationErr)
+		}
+		if migrationErr.Err == nil || errors.Unwrap(err) != migrationErr.Err {
+			t.Errorf("Expected the driver error to be wrapped. Got %v", migrationErr.Err)
+		}
+
 		query := "SELECT * FROM " + migrator.QuotedTableName()
 		rows, _ := db.Query(query)
 
@@ -148,6 +202,41 @@ func TestFailedMigration(t *testing.T) {
 
 }
 
+// TestPerMigrationTransactionMode ensures that, in PerMigration mode, a
+// failing migration doesn't roll back the migrations which preceded it.
+func TestPerMigrationTransactionMode(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithTransactionMode(PerMigration))
+		dataTable := fmt.Sprintf("per_migration_%d", rand.Int()) // #nosec we don't need cryptographic security here
+		migrations := []*Migration{
+			{
+				ID:     "2021-01-01 001 Good",
+				Script: fmt.Sprintf("CREATE TABLE %s (number INTEGER)", dataTable),
+			},
+			{
+				ID:     "2021-01-01 002 Bad",
+				Script: "CREATE TIBBLE bad_table_name (id INTEGER NOT NULL PRIMARY KEY)",
+			},
+		}
+		err := migrator.Apply(db, migrations)
+		expectErrorContains(t, err, "TIBBLE")
+
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, exists := applied[migrations[0].ID]; !exists {
+			t.Errorf("Expected '%s' to remain applied", migrations[0].ID)
+		}
+		if _, exists := applied[migrations[1].ID]; exists {
+			t.Errorf("Expected '%s' not to be recorded", migrations[1].ID)
+		}
+	})
+}
+
 // TestSimultaneousApply creates multiple Migrators and multiple distinct
 // connections to each test database and attempts to call .Apply() on them all
 // concurrently. The migrations include an INSERT statement, which allows us
@@ -266,6 +355,9 @@ func TestMultiSchemaSupport(t *testing.T) {
 			} else {
 				t.Errorf("Expected rows")
 			}
+			if rows != nil {
+				_ = rows.Close()
+			}
 			if actualCount != expectedRowCount {
 				t.Errorf("Expected %d rows in table %s. Got %d", expectedRowCount, qtn, actualCount)
 			}
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"hash/crc32"
 	"strings"
@@ -11,21 +12,56 @@ import (
 
 const mssqlAdvisoryLockSalt uint32 = 542384964
 
+// mssqlMaxLockResourceLength is the longest @Resource sp_getapplock accepts
+const mssqlMaxLockResourceLength = 255
+
+// mssqlLockDescriptionLength is how much of an application lock's resource
+// appears in sys.dm_tran_locks
+const mssqlLockDescriptionLength = 32
+
 // MSSQL is the dialect for MS SQL-compatible databases
 var MSSQL = mssqlDialect{}
 
-type mssqlDialect struct{}
+type mssqlDialect struct {
+	// lockNamespace is the namespace supplied to KeyedLocker
+	lockNamespace string
+}
 
 // Lock implements the Locker interface to obtain a global lock before the
 // migrations are run. It uses SQL Server's sp_getapplock stored procedure
 // with a session-based lock to ensure that only one process can run migrations
 // at a time, which is critical for clustered environments.
 func (s mssqlDialect) Lock(ctx context.Context, tx Queryer, tableName string) error {
+	// A @LockTimeout of -1 waits indefinitely
+	return s.getAppLock(ctx, tx, tableName, -1)
+}
+
+// LockWithTimeout implements the TimeoutLocker interface by passing the
+// timeout to sp_getapplock as its @LockTimeout.
+func (s mssqlDialect) LockWithTimeout(ctx context.Context, tx Queryer, tableName string, timeout time.Duration) error {
+	return s.getAppLock(ctx, tx, tableName, timeout.Milliseconds())
+}
+
+// getAppLock calls sp_getapplock and checks its return code, which is
+// negative when the lock was not granted.
+func (s mssqlDialect) getAppLock(ctx context.Context, tx Queryer, tableName string, timeoutMillis int64) error {
 	lockID := s.advisoryLockID(tableName)
 	// Use application lock without explicit transaction
-	query := fmt.Sprintf("EXEC sp_getapplock @Resource = '%d', @LockMode = 'Exclusive', @LockOwner = 'Session';", lockID)
-	_, err := tx.ExecContext(ctx, query)
-	return err
+	query := fmt.Sprintf(`DECLARE @result int;
+EXEC @result = sp_getapplock @Resource = '%s', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = %d;
+SELECT @result;`, lockID, timeoutMillis)
+
+	var result int
+	err := queryScalar(ctx, tx, &result, query)
+	switch {
+	case err != nil:
+		return err
+	case result == -1:
+		return fmt.Errorf("%w: application lock '%s' is held by another session", ErrLockTimeout, lockID)
+	case result < 0:
+		return fmt.Errorf("sp_getapplock failed for '%s' with return code %d", lockID, result)
+	}
+	return nil
 }
 
 // Unlock implements the Locker interface to release the global lock after the
@@ -46,16 +82,54 @@ func (s mssqlDialect) Unlock(ctx context.Context, tx Queryer, tableName string)
 	}
 
 	// Release the application lock
-	query := fmt.Sprintf("EXEC sp_releaseapplock @Resource = '%d', @LockOwner = 'Session';", lockID)
+	query := fmt.Sprintf("EXEC sp_releaseapplock @Resource = '%s', @LockOwner = 'Session';", lockID)
 	_, err = tx.ExecContext(ctx, query)
 	return err
 }
 
+// KeyedLocker implements the LockKeyer interface. The application lock's
+// resource is named after the namespace and the tracking table.
+func (s mssqlDialect) KeyedLocker(namespace string) Locker {
+	return mssqlDialect{lockNamespace: namespace}
+}
+
+// LockStatus implements the LockInspector interface. The session holding
+// the application lock is found in sys.dm_tran_locks, and described using
+// sys.dm_exec_sessions. This requires the VIEW SERVER STATE permission.
+func (s mssqlDialect) LockStatus(ctx context.Context, tx Queryer, tableName string) (*LockStatus, error) {
+	// Application lock resource descriptions look like "0:[resource]:(hash)",
+	// with long resources cut short
+	resource := []rune(s.lockResource(tableName))
+	description := ":[" + string(resource) + "]:"
+	if len(resource) > mssqlLockDescriptionLength {
+		description = ":[" + string(resource[:mssqlLockDescriptionLength])
+	}
+	query := fmt.Sprintf(`
+		SELECT TOP 1 l.request_session_id, COALESCE(es.host_name, ''), COALESCE(es.login_name, ''), es.login_time
+		FROM sys.dm_tran_locks l
+		LEFT JOIN sys.dm_exec_sessions es ON es.session_id = l.request_session_id
+		WHERE l.resource_type = 'APPLICATION'
+			AND l.resource_database_id = DB_ID()
+			AND l.request_status = 'GRANT'
+			AND CHARINDEX(N'%s', l.resource_description) > 0
+	`, strings.ReplaceAll(description, "'", "''"))
+
+	status := &LockStatus{}
+	var since sql.NullTime
+	found, err := queryRow(ctx, tx, query, nil, &status.Holder, &status.Host, &status.User, &since)
+	if err != nil || !found {
+		return status, err
+	}
+	status.Held = true
+	status.Since = since.Time
+	return status, nil
+}
+
 // getLockMode checks if we currently hold a lock and returns the lock mode.
 // This is extracted to a helper to ensure rows are properly closed before
 // any subsequent queries on the same connection.
-func (s mssqlDialect) getLockMode(ctx context.Context, tx Queryer, lockID uint32) (string, error) {
-	query := fmt.Sprintf("SELECT APPLOCK_MODE('public', '%d', 'Session');", lockID)
+func (s mssqlDialect) getLockMode(ctx context.Context, tx Queryer, lockID string) (string, error) {
+	query := fmt.Sprintf("SELECT APPLOCK_MODE('public', '%s', 'Session');", lockID)
 	rows, err := tx.QueryContext(ctx, query)
 	if err != nil {
 		return "", fmt.Errorf("error checking lock status: %w", err)
@@ -71,11 +145,54 @@ func (s mssqlDialect) getLockMode(ctx context.Context, tx Queryer, lockID uint32
 	return lockMode, nil
 }
 
-// advisoryLockID generates a consistent integer ID for use with SQL Server's sp_getapplock
-// based on the table name. It uses a CRC32 checksum of the table name XORed with a salt
-// to ensure uniqueness across different applications using the same database.
-func (s mssqlDialect) advisoryLockID(tableName string) uint32 {
-	return crc32.ChecksumIEEE([]byte(tableName)) ^ mssqlAdvisoryLockSalt
+// advisoryLockID returns the lock's resource name, escaped for use in a
+// string literal
+func (s mssqlDialect) advisoryLockID(tableName string) string {
+	return strings.ReplaceAll(s.lockResource(tableName), "'", "''")
+}
+
+// lockResource generates a consistent resource name for use with SQL Server's
+// sp_getapplock based on the table name. It uses a CRC32 checksum of the table
+// name XORed with a salt to ensure uniqueness across different applications
+// using the same database, or the namespace supplied to KeyedLocker followed
+// by the table name.
+func (s mssqlDialect) lockResource(tableName string) string {
+	if s.lockNamespace != "" {
+		return namespacedLockName(s.lockNamespace, tableName, mssqlMaxLockResourceLength)
+	}
+	return fmt.Sprint(crc32.ChecksumIEEE([]byte(tableName)) ^ mssqlAdvisoryLockSalt)
+}
+
+// mssqlLexicalRules describe how SQL Server scripts are split into batches.
+// Only GO lines separate batches; semicolons are left to the server.
+var mssqlLexicalRules = lexicalRules{
+	brackets:       true,
+	nestedComments: true,
+	batchSeparator: true,
+}
+
+// SplitStatements breaks a SQL Server script into the batches separated by
+// its GO lines. Each batch is executed as a single statement, so procedures,
+// triggers and views can be created in a batch of their own.
+func (s mssqlDialect) SplitStatements(script string) ([]Statement, error) {
+	return splitStatements(script, mssqlLexicalRules)
+}
+
+// scriptRules returns the lexical rules of SQL Server scripts
+func (s mssqlDialect) scriptRules() lexicalRules {
+	return mssqlLexicalRules
+}
+
+// CreateTableIfNotExists implements the HelperTables interface
+func (s mssqlDialect) CreateTableIfNotExists(ctx context.Context, tx Queryer, tableName, columns string) error {
+	query := fmt.Sprintf(`IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s %s`, strings.ReplaceAll(tableName, "'", "''"), tableName, columns)
+	_, err := tx.ExecContext(ctx, query)
+	return err
+}
+
+// Placeholder implements the HelperTables interface
+func (s mssqlDialect) Placeholder(n int) string {
+	return fmt.Sprintf("@p%d", n)
 }
 
 func (s mssqlDialect) QuotedTableName(schemaName, tableName string) string {
@@ -166,6 +283,100 @@ func (s mssqlDialect) InsertAppliedMigration(ctx context.Context, tx Queryer, ta
 		( @p1, @p2, @p3, @p4 )`,
 		tableName,
 	)
-	_, err := tx.ExecContext(ctx, query, am.ID, am.MD5(), am.ExecutionTimeInMillis, am.AppliedAt)
+	_, err := tx.ExecContext(ctx, query, am.ID, am.checksum(), am.ExecutionTimeInMillis, am.AppliedAt)
+	return err
+}
+
+// UpgradeMigrationsTable implements the MigrationsTableUpgrader interface to
+// bring the tracking table up to the supplied version of its structure
+func (s mssqlDialect) UpgradeMigrationsTable(ctx context.Context, tx Queryer, tableName string, version int) error {
+	switch version {
+	case 2:
+		return s.widenChecksum(ctx, tx, tableName)
+	default:
+		return fmt.Errorf("no upgrade to version %d of the tracking table", version)
+	}
+}
+
+// widenChecksum makes room in the checksum column for prefixed checksums
+func (s mssqlDialect) widenChecksum(ctx context.Context, tx Queryer, tableName string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN checksum VARCHAR(255) NOT NULL`, tableName))
+	return err
+}
+
+// UpdateChecksum implements the ChecksumUpdater interface to replace the
+// checksum recorded for an applied migration
+func (s mssqlDialect) UpdateChecksum(ctx context.Context, tx Queryer, tableName, id, checksum string) error {
+	query := fmt.Sprintf(`UPDATE %s SET checksum = @p1 WHERE id = @p2`, tableName)
+	_, err := tx.ExecContext(ctx, query, checksum, id)
+	return err
+}
+
+// DeleteAppliedMigration implements the AppliedMigrationDeleter interface to
+// remove the tracking table row of an applied migration
+func (s mssqlDialect) DeleteAppliedMigration(ctx context.Context, tx Queryer, tableName, id string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = @p1`, tableName)
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+// ExtendMigrationsTable implements the ExtendedTracker interface to add the
+// extended tracking columns to the tracking table
+func (s mssqlDialect) ExtendMigrationsTable(ctx context.Context, tx Queryer, tableName string) error {
+	query := fmt.Sprintf(`
+		IF COL_LENGTH(N'%s', 'applied_by') IS NULL
+			ALTER TABLE %s ADD
+				applied_by VARCHAR(255) NOT NULL DEFAULT '',
+				hostname VARCHAR(255) NOT NULL DEFAULT '',
+				app_version VARCHAR(255) NOT NULL DEFAULT '',
+				script NVARCHAR(MAX) NULL
+	`, strings.ReplaceAll(tableName, "'", "''"), tableName)
+	_, err := tx.ExecContext(ctx, query)
+	return err
+}
+
+// InsertExtendedAppliedMigration implements the ExtendedTracker interface to
+// insert a record, including the extended columns, into the migrations
+// tracking table *after* a migration has successfully run.
+func (s mssqlDialect) InsertExtendedAppliedMigration(ctx context.Context, tx Queryer, tableName string, am *AppliedMigration) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s
+		( id, checksum, execution_time_in_millis, applied_at, applied_by, hostname, app_version, script )
+		VALUES
+		( @p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8 )`,
+		tableName,
+	)
+	_, err := tx.ExecContext(ctx, query, am.ID, am.checksum(), am.ExecutionTimeInMillis, am.AppliedAt, am.AppliedBy, am.Hostname, am.AppVersion, am.Script)
 	return err
 }
+
+// GetExtendedAppliedMigrations implements the ExtendedTracker interface to
+// retrieve all data, including the extended columns, from the migrations
+// tracking table
+func (s mssqlDialect) GetExtendedAppliedMigrations(ctx context.Context, tx Queryer, tableName string) (migrations []*AppliedMigration, err error) {
+	migrations = make([]*AppliedMigration, 0)
+
+	query := fmt.Sprintf(`
+		SELECT id, checksum, execution_time_in_millis, applied_at, applied_by, hostname, app_version, COALESCE(script, '')
+		FROM %s ORDER BY id ASC
+	`, tableName)
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return migrations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		migration := AppliedMigration{}
+		err = rows.Scan(&migration.ID, &migration.Checksum, &migration.ExecutionTimeInMillis, &migration.AppliedAt, &migration.AppliedBy, &migration.Hostname, &migration.AppVersion, &migration.Script)
+		if err != nil {
+			err = fmt.Errorf("failed to GetExtendedAppliedMigrations. Did somebody change the structure of the %s table?: %w", tableName, err)
+			return migrations, err
+		}
+		migration.AppliedAt = migration.AppliedAt.In(time.Local)
+		migrations = append(migrations, &migration)
+	}
+
+	return migrations, err
+}
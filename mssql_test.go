@@ -3,9 +3,12 @@ package schema
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math/rand"
 	"strings"
 	"testing"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	// MSSQL Driver
@@ -14,7 +17,17 @@ import (
 
 // Interface verification that MSSQL is a valid Dialect
 var (
-	_ Dialect = MSSQL
+	_ Dialect       = MSSQL
+	_ Locker        = MSSQL
+	_ TimeoutLocker = MSSQL
+	_ LockInspector = MSSQL
+	_ LockKeyer     = MSSQL
+
+	_ ExtendedTracker         = MSSQL
+	_ MigrationsTableUpgrader = MSSQL
+	_ ChecksumUpdater         = MSSQL
+	_ AppliedMigrationDeleter = MSSQL
+	_ HelperTables            = MSSQL
 )
 
 func TestMSSQLQuotedTableName(t *testing.T) {
@@ -110,7 +123,7 @@ func TestMSSQLGetLockModeScanError(t *testing.T) {
 	}
 	defer conn.Close()
 
-	_, err = mssqlDialect{}.getLockMode(context.Background(), conn, 12345)
+	_, err = mssqlDialect{}.getLockMode(context.Background(), conn, "12345")
 	if err == nil {
 		t.Error("Expected error from scan, got nil")
 	}
@@ -143,3 +156,72 @@ func TestMSSQLCreateMigrationsTableConcurrentError(t *testing.T) {
 		t.Errorf("Expected nil error for concurrent creation, got: %s", err)
 	}
 }
+
+// TestMSSQLGoBatches ensures that scripts with GO separators, including
+// procedures which must start their own batch, can be applied
+func TestMSSQLGoBatches(t *testing.T) {
+	withTestDB(t, "mssql:latest", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		table := fmt.Sprintf("batches_%d", rand.Int()) // #nosec we don't need cryptographic security here
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		err := migrator.Apply(db, []*Migration{{
+			ID: "2021-01-01 Batches",
+			Script: fmt.Sprintf(
+				"CREATE TABLE %s (id INT IDENTITY(1,1) PRIMARY KEY)\nGO\nCREATE PROCEDURE %s_insert AS INSERT INTO %s DEFAULT VALUES\nGO\nEXEC %s_insert\nGO 3\n",
+				table, table, table, table,
+			),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var count int
+		err = db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Errorf("Expected GO 3 to insert 3 rows. Got %d", count)
+		}
+	})
+}
+
+func TestMSSQLLockChecksReturnCode(t *testing.T) {
+	tests := map[string]struct {
+		returnCode int
+		check      func(err error) bool
+	}{
+		"Granted":  {0, func(err error) bool { return err == nil }},
+		"Waited":   {1, func(err error) bool { return err == nil }},
+		"TimedOut": {-1, func(err error) bool { return errors.Is(err, ErrLockTimeout) }},
+		"Deadlock": {-3, func(err error) bool { return err != nil && !errors.Is(err, ErrLockTimeout) }},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			mock.ExpectQuery("@LockTimeout = 1500;").WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow(test.returnCode))
+			err := MSSQL.LockWithTimeout(context.Background(), db, "[schema_migrations]", 1500*time.Millisecond)
+			if !test.check(err) {
+				t.Errorf("Unexpected result for return code %d: %v", test.returnCode, err)
+			}
+		})
+	}
+}
+
+func TestMSSQLLockStatus(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	since := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"session", "host", "login", "login_time"}).AddRow(61, "build-agent", "deployer", since)
+	mock.ExpectQuery("FROM sys.dm_tran_locks").WillReturnRows(rows)
+
+	status, err := MSSQL.LockStatus(context.Background(), db, "[schema_migrations]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := LockStatus{Held: true, Holder: "61", Host: "build-agent", User: "deployer", Since: since}
+	if *status != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *status)
+	}
+}
@@ -2,26 +2,57 @@ package schema
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"hash/crc32"
+	"math"
 	"strings"
 	"time"
 )
 
 const mysqlLockSalt uint32 = 271192482
 
+// mysqlDefaultLockTimeout is how long Lock waits for GET_LOCK when no
+// timeout has been configured with WithLockTimeout
+const mysqlDefaultLockTimeout = 10 * time.Second
+
+// mysqlMaxLockNameLength is the longest name GET_LOCK accepts
+const mysqlMaxLockNameLength = 64
+
 // MySQL is the dialect which should be used for MySQL/MariaDB databases
 var MySQL = mysqlDialect{}
 
-type mysqlDialect struct{}
+type mysqlDialect struct {
+	// lockNamespace is the namespace supplied to KeyedLocker
+	lockNamespace string
+}
 
 // Lock implements the Locker interface to obtain a global lock before the
-// migrations are run.
+// migrations are run. It waits up to 10 seconds for the lock.
 func (m mysqlDialect) Lock(ctx context.Context, tx Queryer, tableName string) error {
+	return m.LockWithTimeout(ctx, tx, tableName, mysqlDefaultLockTimeout)
+}
+
+// LockWithTimeout implements the TimeoutLocker interface. GET_LOCK only
+// accepts whole seconds, so the timeout is rounded up. It returns
+// ErrLockTimeout if another session still holds the lock when the timeout
+// expires.
+func (m mysqlDialect) LockWithTimeout(ctx context.Context, tx Queryer, tableName string, timeout time.Duration) error {
 	lockID := m.advisoryLockID(tableName)
-	query := fmt.Sprintf(`SELECT GET_LOCK('%s', 10)`, lockID)
-	_, err := tx.ExecContext(ctx, query)
-	return err
+	seconds := int64(math.Ceil(timeout.Seconds()))
+	query := fmt.Sprintf(`SELECT GET_LOCK('%s', %d)`, lockID, seconds)
+
+	var result sql.NullInt64
+	err := queryScalar(ctx, tx, &result, query)
+	switch {
+	case err != nil:
+		return err
+	case !result.Valid:
+		return fmt.Errorf("GET_LOCK('%s') failed", lockID)
+	case result.Int64 != 1:
+		return fmt.Errorf("%w: '%s' is held by another session", ErrLockTimeout, lockID)
+	}
+	return nil
 }
 
 // Unlock implements the Locker interface to release the global lock after the
@@ -33,6 +64,32 @@ func (m mysqlDialect) Unlock(ctx context.Context, tx Queryer, tableName string)
 	return err
 }
 
+// KeyedLocker implements the LockKeyer interface. The lock is named after the
+// namespace and the tracking table.
+func (m mysqlDialect) KeyedLocker(namespace string) Locker {
+	return mysqlDialect{lockNamespace: namespace}
+}
+
+// LockStatus implements the LockInspector interface. IS_USED_LOCK reports the
+// connection ID holding the lock, which is described using the process list.
+func (m mysqlDialect) LockStatus(ctx context.Context, tx Queryer, tableName string) (*LockStatus, error) {
+	query := fmt.Sprintf(`
+		SELECT l.id, COALESCE(p.HOST, ''), COALESCE(p.USER, '')
+		FROM (SELECT IS_USED_LOCK('%s') AS id) l
+		LEFT JOIN information_schema.PROCESSLIST p ON p.ID = l.id
+	`, m.advisoryLockID(tableName))
+
+	status := &LockStatus{}
+	var connectionID sql.NullInt64
+	_, err := queryRow(ctx, tx, query, nil, &connectionID, &status.Host, &status.User)
+	if err != nil || !connectionID.Valid {
+		return status, err
+	}
+	status.Held = true
+	status.Holder = fmt.Sprint(connectionID.Int64)
+	return status, nil
+}
+
 // CreateMigrationsTable implements the Dialect interface to create the
 // table which tracks applied migrations. It only creates the table if it
 // does not already exist
@@ -59,7 +116,7 @@ func (m mysqlDialect) InsertAppliedMigration(ctx context.Context, tx Queryer, ta
 		( ?, ?, ?, ? )
 		`, tableName,
 	)
-	_, err := tx.ExecContext(ctx, query, am.ID, am.MD5(), am.ExecutionTimeInMillis, am.AppliedAt)
+	_, err := tx.ExecContext(ctx, query, am.ID, am.checksum(), am.ExecutionTimeInMillis, am.AppliedAt)
 	return err
 }
 
@@ -93,6 +150,142 @@ func (m mysqlDialect) GetAppliedMigrations(ctx context.Context, tx Queryer, tabl
 	return migrations, err
 }
 
+// UpgradeMigrationsTable implements the MigrationsTableUpgrader interface to
+// bring the tracking table up to the supplied version of its structure
+func (m mysqlDialect) UpgradeMigrationsTable(ctx context.Context, tx Queryer, tableName string, version int) error {
+	switch version {
+	case 2:
+		return m.widenChecksum(ctx, tx, tableName)
+	default:
+		return fmt.Errorf("no upgrade to version %d of the tracking table", version)
+	}
+}
+
+// widenChecksum makes room in the checksum column for prefixed checksums
+func (m mysqlDialect) widenChecksum(ctx context.Context, tx Queryer, tableName string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s MODIFY checksum VARCHAR(255) NOT NULL DEFAULT ''`, tableName))
+	return err
+}
+
+// UpdateChecksum implements the ChecksumUpdater interface to replace the
+// checksum recorded for an applied migration
+func (m mysqlDialect) UpdateChecksum(ctx context.Context, tx Queryer, tableName, id, checksum string) error {
+	query := fmt.Sprintf(`UPDATE %s SET checksum = ? WHERE id = ?`, tableName)
+	_, err := tx.ExecContext(ctx, query, checksum, id)
+	return err
+}
+
+// DeleteAppliedMigration implements the AppliedMigrationDeleter interface to
+// remove the tracking table row of an applied migration
+func (m mysqlDialect) DeleteAppliedMigration(ctx context.Context, tx Queryer, tableName, id string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, tableName)
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+// ExtendMigrationsTable implements the ExtendedTracker interface to add the
+// extended tracking columns to the tracking table. MySQL lacks ADD COLUMN IF
+// NOT EXISTS, so the table is checked for the columns first.
+func (m mysqlDialect) ExtendMigrationsTable(ctx context.Context, tx Queryer, tableName string) error {
+	_, err := queryRow(ctx, tx, fmt.Sprintf(`SELECT applied_by FROM %s LIMIT 0`, tableName), nil)
+	if err == nil {
+		return nil
+	}
+
+	query := fmt.Sprintf(`
+		ALTER TABLE %s
+			ADD COLUMN applied_by VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN hostname VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN app_version VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN script LONGTEXT NULL
+	`, tableName)
+	_, err = tx.ExecContext(ctx, query)
+	return err
+}
+
+// InsertExtendedAppliedMigration implements the ExtendedTracker interface to
+// insert a record, including the extended columns, into the migrations
+// tracking table *after* a migration has successfully run.
+func (m mysqlDialect) InsertExtendedAppliedMigration(ctx context.Context, tx Queryer, tableName string, am *AppliedMigration) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s
+		( id, checksum, execution_time_in_millis, applied_at, applied_by, hostname, app_version, script )
+		VALUES
+		( ?, ?, ?, ?, ?, ?, ?, ? )
+		`, tableName,
+	)
+	_, err := tx.ExecContext(ctx, query, am.ID, am.checksum(), am.ExecutionTimeInMillis, am.AppliedAt, am.AppliedBy, am.Hostname, am.AppVersion, am.Script)
+	return err
+}
+
+// GetExtendedAppliedMigrations implements the ExtendedTracker interface to
+// retrieve all data, including the extended columns, from the migrations
+// tracking table
+func (m mysqlDialect) GetExtendedAppliedMigrations(ctx context.Context, tx Queryer, tableName string) (migrations []*AppliedMigration, err error) {
+	migrations = make([]*AppliedMigration, 0)
+
+	query := fmt.Sprintf(`
+		SELECT id, checksum, execution_time_in_millis, applied_at, applied_by, hostname, app_version, COALESCE(script, '')
+		FROM %s
+		ORDER BY id ASC`, tableName)
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return migrations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		migration := AppliedMigration{}
+
+		var appliedAt mysqlTime
+		err = rows.Scan(&migration.ID, &migration.Checksum, &migration.ExecutionTimeInMillis, &appliedAt, &migration.AppliedBy, &migration.Hostname, &migration.AppVersion, &migration.Script)
+		if err != nil {
+			err = fmt.Errorf("Failed to GetExtendedAppliedMigrations. Did somebody change the structure of the %s table?: %w", tableName, err)
+			return migrations, err
+		}
+		migration.AppliedAt = appliedAt.Value
+		migrations = append(migrations, &migration)
+	}
+
+	return migrations, err
+}
+
+// mysqlLexicalRules describe how MySQL scripts are split into statements.
+// DELIMITER lines are honored like the mysql client does, and BEGIN ... END
+// compound statements are kept intact even without them.
+var mysqlLexicalRules = lexicalRules{
+	backslashEscapes:      true,
+	backticks:             true,
+	hashComments:          true,
+	dashCommentNeedsSpace: true,
+	delimiterCommand:      true,
+	blockBegins: func(next string) bool {
+		// BEGIN and BEGIN WORK start transactions rather than blocks
+		return next != "" && next != "WORK"
+	},
+}
+
+// SplitStatements breaks a MySQL script into individual statements
+func (m mysqlDialect) SplitStatements(script string) ([]Statement, error) {
+	return splitStatements(script, mysqlLexicalRules)
+}
+
+// scriptRules returns the lexical rules of MySQL scripts
+func (m mysqlDialect) scriptRules() lexicalRules {
+	return mysqlLexicalRules
+}
+
+// CreateTableIfNotExists implements the HelperTables interface
+func (m mysqlDialect) CreateTableIfNotExists(ctx context.Context, tx Queryer, tableName, columns string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s %s`, tableName, columns))
+	return err
+}
+
+// Placeholder implements the HelperTables interface
+func (m mysqlDialect) Placeholder(n int) string {
+	return "?"
+}
+
 // QuotedTableName returns the string value of the name of the migration
 // tracking table after it has been quoted for MySQL
 func (m mysqlDialect) QuotedTableName(schemaName, tableName string) string {
@@ -111,8 +304,13 @@ func (m mysqlDialect) quotedIdent(ident string) string {
 	return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
 }
 
-// advisoryLockID generates a table-specific lock name to use
+// advisoryLockID generates a table-specific lock name to use, escaped for
+// use in a string literal
 func (m mysqlDialect) advisoryLockID(tableName string) string {
+	if m.lockNamespace != "" {
+		name := namespacedLockName(m.lockNamespace, tableName, mysqlMaxLockNameLength)
+		return strings.NewReplacer(`\`, `\\`, "'", "''").Replace(name)
+	}
 	sum := crc32.ChecksumIEEE([]byte(tableName))
 	sum = sum * mysqlLockSalt
 	return fmt.Sprint(sum)
@@ -1,17 +1,29 @@
 package schema
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	// MySQL Driver
 	_ "github.com/go-sql-driver/mysql"
 )
 
 // Interface verification that MySQL is a valid Dialect
 var (
-	_ Dialect = MySQL
-	_ Locker  = MySQL
+	_ Dialect       = MySQL
+	_ Locker        = MySQL
+	_ TimeoutLocker = MySQL
+	_ LockInspector = MySQL
+	_ LockKeyer     = MySQL
+
+	_ ExtendedTracker         = MySQL
+	_ MigrationsTableUpgrader = MySQL
+	_ ChecksumUpdater         = MySQL
+	_ AppliedMigrationDeleter = MySQL
+	_ HelperTables            = MySQL
 )
 
 func TestMySQLQuotedTableName(t *testing.T) {
@@ -91,3 +103,108 @@ func (nsl nullMySQLLogger) Print(v ...interface{}) {
 	// the MySQL driver errors which occur while we're waiting for the Docker
 	// MySQL instance to start up.
 }
+
+func TestMySQLLockChecksResult(t *testing.T) {
+	lockQuery := `^SELECT GET_LOCK\('\d+', 10\)$`
+
+	t.Run("Acquired", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(lockQuery).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+		err := MySQL.Lock(context.Background(), db, "`schema_migrations`")
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("TimedOut", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(lockQuery).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+		err := MySQL.Lock(context.Background(), db, "`schema_migrations`")
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout. Got %v", err)
+		}
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(lockQuery).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(nil))
+		err := MySQL.Lock(context.Background(), db, "`schema_migrations`")
+		if err == nil || errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected a non-timeout error for a NULL result. Got %v", err)
+		}
+	})
+
+	t.Run("QueryError", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(lockQuery).WillReturnError(ErrLockFailed)
+		err := MySQL.Lock(context.Background(), db, "`schema_migrations`")
+		if !errors.Is(err, ErrLockFailed) {
+			t.Errorf("Expected ErrLockFailed. Got %v", err)
+		}
+	})
+}
+
+func TestMySQLLockWithTimeout(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(`^SELECT GET_LOCK\('\d+', 2\)$`).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	err := MySQL.LockWithTimeout(context.Background(), db, "`schema_migrations`", 1500*time.Millisecond)
+	if err != nil {
+		t.Error(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestMySQLLockTimeout ensures that a second Migrator gives up with
+// ErrLockTimeout while another session holds the lock
+func TestMySQLLockTimeout(t *testing.T) {
+	withTestDB(t, "mysql:latest", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(MySQL), WithLockTimeout(time.Second))
+		holder, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = holder.Close() }()
+		err = MySQL.Lock(context.Background(), holder, migrator.QuotedTableName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = MySQL.Unlock(context.Background(), holder, migrator.QuotedTableName()) }()
+
+		err = migrator.Apply(db, testMigrations(t, "useless-ansi"))
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout. Got %v", err)
+		}
+	})
+}
+
+func TestMySQLLockStatus(t *testing.T) {
+	t.Run("Free", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery("IS_USED_LOCK").WillReturnRows(sqlmock.NewRows([]string{"id", "host", "user"}).AddRow(nil, "", ""))
+		status, err := MySQL.LockStatus(context.Background(), db, "`schema_migrations`")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Held {
+			t.Errorf("Expected the lock to be free. Got %+v", status)
+		}
+	})
+
+	t.Run("Held", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery("IS_USED_LOCK").WillReturnRows(sqlmock.NewRows([]string{"id", "host", "user"}).AddRow(17, "10.0.0.7:5123", "deployer"))
+		status, err := MySQL.LockStatus(context.Background(), db, "`schema_migrations`")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := LockStatus{Held: true, Holder: "17", Host: "10.0.0.7:5123", User: "deployer"}
+		if *status != expected {
+			t.Errorf("Expected %+v, got %+v", expected, *status)
+		}
+	})
+}
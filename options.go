@@ -1,6 +1,9 @@
 package schema
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Option supports option chaining when creating a Migrator.
 // An Option is a function which takes a Migrator and
@@ -61,3 +64,179 @@ func WithLogger(logger Logger) Option {
 		return m
 	}
 }
+
+// Policy determines how a Migrator reacts when it detects a suspicious, but
+// not necessarily fatal, condition while planning migrations.
+type Policy int
+
+const (
+	// PolicyAllow silently permits the condition
+	PolicyAllow Policy = iota
+
+	// PolicyWarn permits the condition, but reports it through the Logger
+	PolicyWarn
+
+	// PolicyFail refuses to apply any migrations and returns an error
+	// describing the condition
+	PolicyFail
+)
+
+// WithUnknownAppliedPolicy builds an Option which determines how Apply reacts
+// when the tracking table contains migrations that aren't among the supplied
+// Migrations. The default is PolicyWarn. Usage:
+// NewMigrator(WithUnknownAppliedPolicy(PolicyFail))
+func WithUnknownAppliedPolicy(policy Policy) Option {
+	return func(m Migrator) Migrator {
+		m.unknownAppliedPolicy = policy
+		return m
+	}
+}
+
+// WithOutOfOrderPolicy builds an Option which determines how Apply reacts to
+// a pending migration whose ID sorts before the newest already-applied
+// migration, as happens when a branch with an older migration is merged late.
+// The default is PolicyAllow. Usage:
+// NewMigrator(WithOutOfOrderPolicy(PolicyFail))
+func WithOutOfOrderPolicy(policy Policy) Option {
+	return func(m Migrator) Migrator {
+		m.outOfOrderPolicy = policy
+		return m
+	}
+}
+
+// TransactionMode determines how Apply groups pending migrations into
+// database transactions.
+type TransactionMode int
+
+const (
+	// AllInOne applies every pending migration in a single transaction, so
+	// that a failure rolls back all of them. This is the default.
+	AllInOne TransactionMode = iota
+
+	// PerMigration applies each pending migration in its own transaction,
+	// together with its tracking table record. A failure only rolls back the
+	// failing migration, leaving the migrations before it applied.
+	PerMigration
+)
+
+// WithTransactionMode builds an Option which determines how pending
+// migrations are grouped into transactions. Usage:
+// NewMigrator(WithTransactionMode(PerMigration))
+func WithTransactionMode(mode TransactionMode) Option {
+	return func(m Migrator) Migrator {
+		m.transactionMode = mode
+		return m
+	}
+}
+
+// WithLockTimeout builds an Option which limits how long Apply (and the other
+// methods which lock the tracking table) wait to obtain the lock before
+// failing with ErrLockTimeout. It applies to dialects which implement
+// TimeoutLocker; the others keep their default behavior. Usage:
+// NewMigrator(WithLockTimeout(30 * time.Second))
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m Migrator) Migrator {
+		m.lockTimeout = timeout
+		return m
+	}
+}
+
+// WithLockRetry builds an Option which retries obtaining the lock when an
+// attempt fails with ErrLockTimeout. Up to retries additional attempts are
+// made, waiting backoff before the first retry and doubling the wait before
+// each one after it. Each attempt is limited by WithLockTimeout, or to 30
+// seconds if no timeout is configured. Only dialects which implement
+// TimeoutLocker (or report ErrLockTimeout themselves) can be retried. Usage:
+// NewMigrator(WithLockTimeout(10*time.Second), WithLockRetry(5, time.Second))
+func WithLockRetry(retries int, backoff time.Duration) Option {
+	return func(m Migrator) Migrator {
+		m.lockRetries = retries
+		m.lockBackoff = backoff
+		return m
+	}
+}
+
+// WithLockKey builds an Option which places the Migrator's lock in the
+// supplied namespace, so that it only excludes other Migrators using the same
+// namespace and tracking table. The Locker must implement LockKeyer, as all of
+// the built-in dialects and LeaseLocker do. On PostgreSQL, the namespace
+// becomes the first half of a two-int advisory lock key: a namespace which is
+// a 32-bit integer is used as-is, and any other namespace is hashed.
+// Usage: NewMigrator(WithLockKey("billing"))
+func WithLockKey(namespace string) Option {
+	return func(m Migrator) Migrator {
+		m.lockKey = namespace
+		return m
+	}
+}
+
+// WithExtendedTracking builds an Option which records the operating system
+// user, hostname and application version (see WithAppVersion) which applied
+// each migration, along with its Script, in additional columns of the
+// tracking table. The columns are added to an existing tracking table if
+// necessary. The Dialect must implement ExtendedTracker, as all of the
+// built-in dialects do.
+func WithExtendedTracking() Option {
+	return func(m Migrator) Migrator {
+		m.extendedTracking = true
+		return m
+	}
+}
+
+// WithAppVersion builds an Option which records the supplied application
+// version, such as a build's commit SHA, alongside each migration it applies.
+// It enables WithExtendedTracking.
+// Usage: NewMigrator(WithAppVersion(buildSHA))
+func WithAppVersion(version string) Option {
+	return func(m Migrator) Migrator {
+		m.extendedTracking = true
+		m.appVersion = version
+		return m
+	}
+}
+
+// WithHistory builds an Option which records every attempt to apply a
+// migration, including failed ones, in a <TableName>_history table. The
+// attempts are written after their transactions have ended, so failures are
+// recorded even though their changes are rolled back. See
+// Migrator.GetMigrationAttempts.
+func WithHistory() Option {
+	return func(m Migrator) Migrator {
+		m.history = true
+		return m
+	}
+}
+
+// WithChecksumAlgorithm builds an Option which sets the ChecksumAlgorithm
+// used to record the Scripts of newly-applied migrations. Checksums recorded
+// with any built-in algorithm are still verified, so the algorithm can be
+// changed on an existing database; see WithChecksumRewrite.
+// Usage: NewMigrator(WithChecksumAlgorithm(SHA256Checksum))
+func WithChecksumAlgorithm(algorithm ChecksumAlgorithm) Option {
+	return func(m Migrator) Migrator {
+		m.checksummer = algorithm
+		return m
+	}
+}
+
+// WithChecksumRewrite builds an Option which makes Apply replace the
+// recorded checksums of unchanged migrations which were applied with a
+// different ChecksumAlgorithm, such as the MD5 checksums recorded by older
+// releases. The Dialect must implement ChecksumUpdater, as all of the
+// built-in dialects do.
+func WithChecksumRewrite() Option {
+	return func(m Migrator) Migrator {
+		m.checksumRewrite = true
+		return m
+	}
+}
+
+// WithLocker builds an Option which replaces the Dialect's own locking (if
+// any) with the supplied Locker, such as a LeaseLocker. Usage:
+// NewMigrator(WithDialect(Postgres), WithLocker(NewLeaseLocker(db, Postgres)))
+func WithLocker(locker Locker) Option {
+	return func(m Migrator) Migrator {
+		m.locker = locker
+		return m
+	}
+}
@@ -2,11 +2,13 @@ package schema
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestWithTableNameOptionWithSchema(t *testing.T) {
@@ -97,6 +99,23 @@ func (nl *StrLog) Print(msgs ...interface{}) {
 	*nl = result
 }
 
+// LogLines is a Logger which keeps every message it is given
+type LogLines []string
+
+func (ll *LogLines) Print(msgs ...interface{}) {
+	*ll = append(*ll, fmt.Sprint(msgs...))
+}
+
+// Contains reports whether any logged line contains substr
+func (ll *LogLines) Contains(substr string) bool {
+	for _, line := range *ll {
+		if strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
 func TestSimpleLogger(t *testing.T) {
 	var str StrLog
 	m := NewMigrator(WithLogger(&str))
@@ -105,3 +124,131 @@ func TestSimpleLogger(t *testing.T) {
 		t.Errorf("Expected logger to print 'Test message'. Got '%s'", str)
 	}
 }
+
+func TestWithUnknownAppliedPolicyOption(t *testing.T) {
+	m := NewMigrator()
+	if m.unknownAppliedPolicy != PolicyWarn {
+		t.Errorf("Expected PolicyWarn by default. Got %d", m.unknownAppliedPolicy)
+	}
+	m = NewMigrator(WithUnknownAppliedPolicy(PolicyFail))
+	if m.unknownAppliedPolicy != PolicyFail {
+		t.Errorf("Expected PolicyFail. Got %d", m.unknownAppliedPolicy)
+	}
+}
+
+func TestWithOutOfOrderPolicyOption(t *testing.T) {
+	m := NewMigrator()
+	if m.outOfOrderPolicy != PolicyAllow {
+		t.Errorf("Expected PolicyAllow by default. Got %d", m.outOfOrderPolicy)
+	}
+	m = NewMigrator(WithOutOfOrderPolicy(PolicyWarn))
+	if m.outOfOrderPolicy != PolicyWarn {
+		t.Errorf("Expected PolicyWarn. Got %d", m.outOfOrderPolicy)
+	}
+}
+
+func TestWithTransactionModeOption(t *testing.T) {
+	m := NewMigrator()
+	if m.transactionMode != AllInOne {
+		t.Errorf("Expected AllInOne by default. Got %d", m.transactionMode)
+	}
+	m = NewMigrator(WithTransactionMode(PerMigration))
+	if m.transactionMode != PerMigration {
+		t.Errorf("Expected PerMigration. Got %d", m.transactionMode)
+	}
+}
+
+func TestWithLockTimeoutOption(t *testing.T) {
+	m := NewMigrator()
+	if m.lockTimeout != 0 {
+		t.Errorf("Expected no lock timeout by default. Got %s", m.lockTimeout)
+	}
+	m = NewMigrator(WithLockTimeout(30 * time.Second))
+	if m.lockTimeout != 30*time.Second {
+		t.Errorf("Expected a 30s lock timeout. Got %s", m.lockTimeout)
+	}
+}
+
+func TestWithLockRetryOption(t *testing.T) {
+	m := NewMigrator()
+	if m.lockRetries != 0 {
+		t.Errorf("Expected no lock retries by default. Got %d", m.lockRetries)
+	}
+	m = NewMigrator(WithLockRetry(3, time.Second))
+	if m.lockRetries != 3 || m.lockBackoff != time.Second {
+		t.Errorf("Expected 3 retries with a 1s backoff. Got %d, %s", m.lockRetries, m.lockBackoff)
+	}
+}
+
+func TestWithLockerOption(t *testing.T) {
+	m := NewMigrator()
+	if l, _ := m.resolveLocker(); l != Postgres {
+		t.Errorf("Expected the Dialect to be the Locker by default. Got %v", l)
+	}
+	m = NewMigrator(WithDialect(SQLite))
+	if l, _ := m.resolveLocker(); l != SQLite {
+		t.Errorf("Expected SQLite to be the Locker. Got %v", l)
+	}
+	locker := NewLeaseLocker(nil, Postgres)
+	m = NewMigrator(WithLocker(locker))
+	if l, _ := m.resolveLocker(); l != locker {
+		t.Errorf("Expected the LeaseLocker. Got %v", l)
+	}
+}
+
+func TestWithLockKeyOption(t *testing.T) {
+	m := NewMigrator(WithLockKey("billing"))
+	if m.lockKey != "billing" {
+		t.Errorf("Expected the lock key to be 'billing'. Got '%s'", m.lockKey)
+	}
+	l, err := m.resolveLocker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != (postgresDialect{lockNamespace: "billing"}) {
+		t.Errorf("Expected a keyed Postgres Locker. Got %v", l)
+	}
+
+	m = NewMigrator(WithLockKey("billing"), WithDialect(&flakyLockDialect{Dialect: Postgres}))
+	_, err = m.resolveLocker()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected errors.ErrUnsupported for a Locker without keys. Got %v", err)
+	}
+}
+
+func TestWithExtendedTrackingOption(t *testing.T) {
+	m := NewMigrator()
+	if m.extendedTracking {
+		t.Errorf("Expected extended tracking to be disabled by default")
+	}
+	m = NewMigrator(WithExtendedTracking())
+	if !m.extendedTracking || m.appVersion != "" {
+		t.Errorf("Expected extended tracking without an app version. Got %v, '%s'", m.extendedTracking, m.appVersion)
+	}
+	m = NewMigrator(WithAppVersion("abc123"))
+	if !m.extendedTracking || m.appVersion != "abc123" {
+		t.Errorf("Expected extended tracking with app version 'abc123'. Got %v, '%s'", m.extendedTracking, m.appVersion)
+	}
+}
+
+func TestWithHistoryOption(t *testing.T) {
+	m := NewMigrator()
+	if m.history {
+		t.Errorf("Expected history to be disabled by default")
+	}
+	m = NewMigrator(WithHistory())
+	if !m.history {
+		t.Errorf("Expected history to be enabled")
+	}
+}
+
+func TestWithChecksumAlgorithmOption(t *testing.T) {
+	m := NewMigrator()
+	if m.checksumAlgorithm() != MD5Checksum || m.checksumRewrite {
+		t.Errorf("Expected MD5 checksums without rewrites by default")
+	}
+	m = NewMigrator(WithChecksumAlgorithm(SHA256Checksum), WithChecksumRewrite())
+	if m.checksumAlgorithm() != SHA256Checksum || !m.checksumRewrite {
+		t.Errorf("Expected rewritten SHA-256 checksums")
+	}
+}
@@ -2,8 +2,11 @@ package schema
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"hash/crc32"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -15,7 +18,10 @@ const postgresAdvisoryLockSalt uint32 = 542384964
 // databases
 var Postgres = postgresDialect{}
 
-type postgresDialect struct{}
+type postgresDialect struct {
+	// lockNamespace is the namespace supplied to KeyedLocker
+	lockNamespace string
+}
 
 // Lock implements the Locker interface to obtain a global lock before the
 // migrations are run.
@@ -26,6 +32,22 @@ func (p postgresDialect) Lock(ctx context.Context, tx Queryer, tableName string)
 	return err
 }
 
+// LockWithTimeout implements the TimeoutLocker interface. Rather than waiting
+// in pg_advisory_lock, it polls pg_try_advisory_lock until the lock is
+// obtained or the timeout expires.
+func (p postgresDialect) LockWithTimeout(ctx context.Context, tx Queryer, tableName string, timeout time.Duration) error {
+	lockID := p.advisoryLockID(tableName)
+	query := fmt.Sprintf("SELECT pg_try_advisory_lock(%s)", lockID)
+	err := pollLock(ctx, timeout, func() (acquired bool, err error) {
+		err = queryScalar(ctx, tx, &acquired, query)
+		return acquired, err
+	})
+	if errors.Is(err, ErrLockTimeout) {
+		return fmt.Errorf("%w: advisory lock %s is held by another session", err, lockID)
+	}
+	return err
+}
+
 // Unlock implements the Locker interface to release the global lock after the
 // migrations are run.
 func (p postgresDialect) Unlock(ctx context.Context, tx Queryer, tableName string) error {
@@ -35,6 +57,41 @@ func (p postgresDialect) Unlock(ctx context.Context, tx Queryer, tableName strin
 	return err
 }
 
+// KeyedLocker implements the LockKeyer interface. The advisory lock uses a
+// two-int key: the namespace, or its hash when it isn't a 32-bit integer,
+// followed by a hash of the tracking table's name.
+func (p postgresDialect) KeyedLocker(namespace string) Locker {
+	return postgresDialect{lockNamespace: namespace}
+}
+
+// LockStatus implements the LockInspector interface. It finds the session
+// holding the advisory lock in pg_locks, and describes it using
+// pg_stat_activity. Other users' sessions are only fully described to
+// superusers and members of pg_read_all_stats.
+func (p postgresDialect) LockStatus(ctx context.Context, tx Queryer, tableName string) (*LockStatus, error) {
+	classID, objID, objSubID := p.advisoryLockKey(tableName)
+	query := fmt.Sprintf(`
+		SELECT l.pid, COALESCE(host(a.client_addr), ''), COALESCE(a.usename, ''), a.backend_start
+		FROM pg_locks l
+		LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory'
+			AND l.classid = %d
+			AND l.objid = %d
+			AND l.objsubid = %d
+			AND l.granted
+	`, classID, objID, objSubID)
+
+	status := &LockStatus{}
+	var since sql.NullTime
+	found, err := queryRow(ctx, tx, query, nil, &status.Holder, &status.Host, &status.User, &since)
+	if err != nil || !found {
+		return status, err
+	}
+	status.Held = true
+	status.Since = since.Time
+	return status, nil
+}
+
 // CreateMigrationsTable implements the Dialect interface to create the
 // table which tracks applied migrations. It only creates the table if it
 // does not already exist
@@ -62,7 +119,7 @@ func (p postgresDialect) InsertAppliedMigration(ctx context.Context, tx Queryer,
 		( $1, $2, $3, $4 )`,
 		tableName,
 	)
-	_, err := tx.ExecContext(ctx, query, am.ID, am.MD5(), am.ExecutionTimeInMillis, am.AppliedAt)
+	_, err := tx.ExecContext(ctx, query, am.ID, am.checksum(), am.ExecutionTimeInMillis, am.AppliedAt)
 	return err
 }
 
@@ -94,6 +151,131 @@ func (p postgresDialect) GetAppliedMigrations(ctx context.Context, tx Queryer, t
 	return migrations, err
 }
 
+// UpgradeMigrationsTable implements the MigrationsTableUpgrader interface to
+// bring the tracking table up to the supplied version of its structure
+func (p postgresDialect) UpgradeMigrationsTable(ctx context.Context, tx Queryer, tableName string, version int) error {
+	switch version {
+	case 2:
+		return p.widenChecksum(ctx, tx, tableName)
+	default:
+		return fmt.Errorf("no upgrade to version %d of the tracking table", version)
+	}
+}
+
+// widenChecksum makes room in the checksum column for prefixed checksums
+func (p postgresDialect) widenChecksum(ctx context.Context, tx Queryer, tableName string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN checksum TYPE VARCHAR(255)`, tableName))
+	return err
+}
+
+// UpdateChecksum implements the ChecksumUpdater interface to replace the
+// checksum recorded for an applied migration
+func (p postgresDialect) UpdateChecksum(ctx context.Context, tx Queryer, tableName, id, checksum string) error {
+	query := fmt.Sprintf(`UPDATE %s SET checksum = $1 WHERE id = $2`, tableName)
+	_, err := tx.ExecContext(ctx, query, checksum, id)
+	return err
+}
+
+// DeleteAppliedMigration implements the AppliedMigrationDeleter interface to
+// remove the tracking table row of an applied migration
+func (p postgresDialect) DeleteAppliedMigration(ctx context.Context, tx Queryer, tableName, id string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, tableName)
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+// ExtendMigrationsTable implements the ExtendedTracker interface to add the
+// extended tracking columns to the tracking table
+func (p postgresDialect) ExtendMigrationsTable(ctx context.Context, tx Queryer, tableName string) error {
+	query := fmt.Sprintf(`
+		ALTER TABLE %s
+			ADD COLUMN IF NOT EXISTS applied_by VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS hostname VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS app_version VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS script TEXT
+	`, tableName)
+	_, err := tx.ExecContext(ctx, query)
+	return err
+}
+
+// InsertExtendedAppliedMigration implements the ExtendedTracker interface to
+// insert a record, including the extended columns, into the migrations
+// tracking table *after* a migration has successfully run.
+func (p postgresDialect) InsertExtendedAppliedMigration(ctx context.Context, tx Queryer, tableName string, am *AppliedMigration) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s
+		( id, checksum, execution_time_in_millis, applied_at, applied_by, hostname, app_version, script )
+		VALUES
+		( $1, $2, $3, $4, $5, $6, $7, $8 )`,
+		tableName,
+	)
+	_, err := tx.ExecContext(ctx, query, am.ID, am.checksum(), am.ExecutionTimeInMillis, am.AppliedAt, am.AppliedBy, am.Hostname, am.AppVersion, am.Script)
+	return err
+}
+
+// GetExtendedAppliedMigrations implements the ExtendedTracker interface to
+// retrieve all data, including the extended columns, from the migrations
+// tracking table
+func (p postgresDialect) GetExtendedAppliedMigrations(ctx context.Context, tx Queryer, tableName string) (migrations []*AppliedMigration, err error) {
+	migrations = make([]*AppliedMigration, 0)
+
+	query := fmt.Sprintf(`
+		SELECT id, checksum, execution_time_in_millis, applied_at, applied_by, hostname, app_version, COALESCE(script, '')
+		FROM %s ORDER BY id ASC
+	`, tableName)
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return migrations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		migration := AppliedMigration{}
+		err = rows.Scan(&migration.ID, &migration.Checksum, &migration.ExecutionTimeInMillis, &migration.AppliedAt, &migration.AppliedBy, &migration.Hostname, &migration.AppVersion, &migration.Script)
+		if err != nil {
+			err = fmt.Errorf("failed to GetExtendedAppliedMigrations. Did somebody change the structure of the %s table?: %w", tableName, err)
+			return migrations, err
+		}
+		migration.AppliedAt = migration.AppliedAt.In(time.Local)
+		migrations = append(migrations, &migration)
+	}
+
+	return migrations, err
+}
+
+// postgresLexicalRules describe how Postgres scripts are split into
+// statements. Dollar-quoted function bodies and E” strings are kept intact,
+// as are BEGIN ATOMIC ... END bodies of SQL-standard functions.
+var postgresLexicalRules = lexicalRules{
+	escapeStrings:  true,
+	dollarQuotes:   true,
+	nestedComments: true,
+	blockBegins: func(next string) bool {
+		return next == "ATOMIC"
+	},
+}
+
+// SplitStatements breaks a Postgres script into individual statements
+func (p postgresDialect) SplitStatements(script string) ([]Statement, error) {
+	return splitStatements(script, postgresLexicalRules)
+}
+
+// scriptRules returns the lexical rules of Postgres scripts
+func (p postgresDialect) scriptRules() lexicalRules {
+	return postgresLexicalRules
+}
+
+// CreateTableIfNotExists implements the HelperTables interface
+func (p postgresDialect) CreateTableIfNotExists(ctx context.Context, tx Queryer, tableName, columns string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s %s`, tableName, columns))
+	return err
+}
+
+// Placeholder implements the HelperTables interface
+func (p postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
 // QuotedTableName returns the string value of the name of the migration
 // tracking table after it has been quoted for Postgres
 func (p postgresDialect) QuotedTableName(schemaName, tableName string) string {
@@ -131,9 +313,30 @@ func (p postgresDialect) QuotedIdent(ident string) string {
 	return sb.String()
 }
 
-// advisoryLockID generates a table-specific lock name to use
+// advisoryLockID generates the table-specific key arguments to pass to the
+// advisory lock functions
 func (p postgresDialect) advisoryLockID(tableName string) string {
-	sum := crc32.ChecksumIEEE([]byte(tableName))
-	sum = sum * postgresAdvisoryLockSalt
-	return fmt.Sprint(sum)
+	classID, objID, objSubID := p.advisoryLockKey(tableName)
+	if objSubID == 1 {
+		return fmt.Sprint(objID)
+	}
+	return fmt.Sprintf("%d, %d", int32(classID), int32(objID))
+}
+
+// advisoryLockKey returns the classid, objid and objsubid which identify the
+// advisory lock in pg_locks. A bigint key is split into classid (high 32
+// bits) and objid (low 32 bits) with an objsubid of 1, while a two-int key
+// has an objsubid of 2.
+func (p postgresDialect) advisoryLockKey(tableName string) (classID, objID uint32, objSubID int) {
+	if p.lockNamespace == "" {
+		return 0, crc32.ChecksumIEEE([]byte(tableName)) * postgresAdvisoryLockSalt, 1
+	}
+
+	namespaceID, err := strconv.ParseInt(p.lockNamespace, 10, 32)
+	if err == nil {
+		classID = uint32(int32(namespaceID))
+	} else {
+		classID = crc32.ChecksumIEEE([]byte(p.lockNamespace))
+	}
+	return classID, crc32.ChecksumIEEE([]byte(tableName)), 2
 }
@@ -1,7 +1,14 @@
 package schema
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
 	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 
 	// Postgres Driver
 	_ "github.com/lib/pq"
@@ -9,8 +16,17 @@ import (
 
 // Interface verification that Postgres is a valid Dialect
 var (
-	_ Dialect = Postgres
-	_ Locker  = Postgres
+	_ Dialect       = Postgres
+	_ Locker        = Postgres
+	_ TimeoutLocker = Postgres
+	_ LockInspector = Postgres
+	_ LockKeyer     = Postgres
+
+	_ ExtendedTracker         = Postgres
+	_ MigrationsTableUpgrader = Postgres
+	_ ChecksumUpdater         = Postgres
+	_ AppliedMigrationDeleter = Postgres
+	_ HelperTables            = Postgres
 )
 
 func TestPostgreSQLQuotedTableName(t *testing.T) {
@@ -46,3 +62,158 @@ func TestPostgreSQLQuotedIdent(t *testing.T) {
 		}
 	}
 }
+
+// TestPostgresNonTransactionalMigration ensures that statements Postgres
+// refuses to run in a transaction can be applied.
+func TestPostgresNonTransactionalMigration(t *testing.T) {
+	withTestDB(t, "postgres:latest", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		table := fmt.Sprintf("concurrent_%d", rand.Int()) // #nosec we don't need cryptographic security here
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		err := migrator.Apply(db, []*Migration{
+			{
+				ID:     "2021-01-01 001 Create Table",
+				Script: fmt.Sprintf("CREATE TABLE %s (name TEXT)", table),
+			},
+			{
+				ID:     "2021-01-01 002 Create Index",
+				Script: fmt.Sprintf("%s\nCREATE INDEX CONCURRENTLY %s_name ON %s (name)", NoTransactionDirective, table, table),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(applied) != 2 {
+			t.Errorf("Expected 2 applied migrations. Got %d", len(applied))
+		}
+	})
+}
+
+func TestPostgresLockWithTimeout(t *testing.T) {
+	t.Run("Acquired", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery("^SELECT pg_try_advisory_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+		mock.ExpectQuery("^SELECT pg_try_advisory_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		err := Postgres.LockWithTimeout(context.Background(), db, `"schema_migrations"`, time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		if err = mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("TimedOut", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery("^SELECT pg_try_advisory_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+		err := Postgres.LockWithTimeout(context.Background(), db, `"schema_migrations"`, 0)
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout. Got %v", err)
+		}
+	})
+}
+
+// TestPostgresLockTimeout ensures that a second Migrator gives up with
+// ErrLockTimeout while another session holds the advisory lock
+func TestPostgresLockTimeout(t *testing.T) {
+	withTestDB(t, "postgres:latest", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithLockTimeout(200*time.Millisecond), WithLockRetry(1, 10*time.Millisecond))
+		holder, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = holder.Close() }()
+		err = Postgres.Lock(context.Background(), holder, migrator.QuotedTableName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = Postgres.Unlock(context.Background(), holder, migrator.QuotedTableName()) }()
+
+		err = migrator.Apply(db, testMigrations(t, "useless-ansi"))
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout. Got %v", err)
+		}
+	})
+}
+
+func TestPostgresLockStatusQuery(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	since := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"pid", "client_addr", "usename", "backend_start"}).AddRow(4242, "10.0.0.7", "deployer", since)
+	mock.ExpectQuery("FROM pg_locks").WillReturnRows(rows)
+
+	status, err := Postgres.LockStatus(context.Background(), db, `"schema_migrations"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := LockStatus{Held: true, Holder: "4242", Host: "10.0.0.7", User: "deployer", Since: since}
+	if *status != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *status)
+	}
+}
+
+// TestPostgresLockStatus ensures that the session holding the advisory lock
+// is reported
+func TestPostgresLockStatus(t *testing.T) {
+	withTestDB(t, "postgres:latest", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator()
+		holder, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = holder.Close() }()
+		err = Postgres.Lock(context.Background(), holder, migrator.QuotedTableName())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		status, err := migrator.LockStatus(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Held || status.Holder == "" {
+			t.Errorf("Expected the lock to be reported as held. Got %+v", status)
+		}
+
+		_ = Postgres.Unlock(context.Background(), holder, migrator.QuotedTableName())
+		status, err = migrator.LockStatus(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Held {
+			t.Errorf("Expected the lock to be released. Got %+v", status)
+		}
+	})
+}
+
+func TestPostgresAdvisoryLockID(t *testing.T) {
+	tests := map[string]struct {
+		locker   postgresDialect
+		expected string
+	}{
+		"Default":          {Postgres, "73299452"},
+		"Namespace":        {postgresDialect{lockNamespace: "billing"}, "-333296470, -1358637745"},
+		"NumericNamespace": {postgresDialect{lockNamespace: "-42"}, "-42, -1358637745"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := test.locker.advisoryLockID(`"schema_migrations"`)
+			if actual != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
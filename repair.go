@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// AppliedMigrationDeleter defines an optional Dialect extension for removing
+// the tracking table row of an applied migration. It is used by Repair to
+// forget migrations which no longer exist.
+type AppliedMigrationDeleter interface {
+	DeleteAppliedMigration(ctx context.Context, tx Queryer, tableName, id string) error
+}
+
+// Repair reconciles the tracking table with the supplied Migrations after
+// applied migrations have been intentionally edited. The recorded checksums
+// of applied migrations whose Scripts have changed are replaced with the
+// checksums of their current Scripts, in the configured ChecksumAlgorithm.
+//
+// When ids are supplied, only those migrations are repaired. Naming an
+// applied migration which is not among the supplied Migrations deletes its
+// row from the tracking table, so that it is no longer reported as unknown;
+// rows are never deleted unless their IDs are named. Each change is logged.
+// Repair holds the Migrator's lock, and makes its changes in a single
+// transaction.
+func (m *Migrator) Repair(db DB, migrations []*Migration, ids ...string) error {
+	if db == nil {
+		return ErrNilDB
+	}
+
+	return m.inLockedTx(db, func(tx Queryer) error {
+		applied, err := m.GetAppliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+
+		byID := make(map[string]*Migration, len(migrations))
+		for _, migration := range migrations {
+			byID[migration.ID] = migration
+		}
+		// Sort a copy, leaving the caller's slice as it was
+		ids := append([]string(nil), ids...)
+		if len(ids) == 0 {
+			for id := range byID {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			am, isApplied := applied[id]
+			migration, exists := byID[id]
+			switch {
+			case !isApplied && exists:
+				// Pending migrations have nothing to repair
+			case !isApplied:
+				return fmt.Errorf("can't repair '%s': it is neither applied nor supplied", id)
+			case !exists:
+				err = m.deleteAppliedMigration(tx, id)
+			case !m.checksumMatches(migration, am):
+				err = m.updateChecksum(tx, migration, am)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// updateChecksum replaces the recorded checksum of an applied migration with
+// the checksum of its current Script
+func (m *Migrator) updateChecksum(tx Queryer, migration *Migration, am *AppliedMigration) error {
+	updater, isUpdater := m.Dialect.(ChecksumUpdater)
+	if !isUpdater {
+		return fmt.Errorf("%T doesn't support updating checksums: %w", m.Dialect, errors.ErrUnsupported)
+	}
+	checksum := m.checksum(migration)
+	err := updater.UpdateChecksum(m.ctx, tx, m.QuotedTableName(), migration.ID, checksum)
+	if err != nil {
+		return err
+	}
+	m.log(fmt.Sprintf("Repaired the checksum of '%s' (%s => %s)", migration.ID, am.Checksum, checksum))
+	return nil
+}
+
+// deleteAppliedMigration removes the tracking table row of an applied
+// migration
+func (m *Migrator) deleteAppliedMigration(tx Queryer, id string) error {
+	deleter, isDeleter := m.Dialect.(AppliedMigrationDeleter)
+	if !isDeleter {
+		return fmt.Errorf("%T doesn't support deleting applied migrations: %w", m.Dialect, errors.ErrUnsupported)
+	}
+	err := deleter.DeleteAppliedMigration(m.ctx, tx, m.QuotedTableName(), id)
+	if err != nil {
+		return err
+	}
+	m.log(fmt.Sprintf("Deleted '%s' from %s", id, m.QuotedTableName()))
+	return nil
+}
@@ -0,0 +1,119 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		var lines LogLines
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithLogger(&lines))
+		migrations := []*Migration{
+			{ID: "2021-01-01 One", Script: "SELECT 1;"},
+			{ID: "2021-01-02 Two", Script: "SELECT 2;"},
+			{ID: "2021-01-03 Three", Script: "SELECT 3;"},
+		}
+		err := migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		edited := make([]*Migration, 0, len(migrations)-1)
+		for _, migration := range migrations[:len(migrations)-1] {
+			edited = append(edited, &Migration{ID: migration.ID, Script: migration.Script + "\n-- Edited"})
+		}
+		removed := migrations[len(migrations)-1].ID
+
+		// Only the named migration is repaired
+		err = migrator.Repair(db, edited, edited[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, _ := migrator.Validate(db, edited)
+		if len(report.ChecksumMismatches) != len(edited)-1 || report.ChecksumMismatches[0].ID != edited[1].ID {
+			t.Errorf("Expected only '%s' to be repaired. Got %+v", edited[0].ID, report.ChecksumMismatches)
+		}
+
+		// Without IDs, every checksum is repaired, but no rows are deleted
+		err = migrator.Repair(db, edited)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, _ = migrator.Validate(db, edited)
+		if len(report.ChecksumMismatches) != 0 || len(report.UnknownApplied) != 1 {
+			t.Errorf("Expected only the unknown migration to remain. Got %+v", report)
+		}
+		if !lines.Contains("Repaired the checksum of '" + edited[1].ID + "'") {
+			t.Errorf("Expected the repair to be logged. Got %v", lines)
+		}
+
+		// Naming an unknown migration deletes it
+		err = migrator.Repair(db, edited, removed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = migrator.Validate(db, edited)
+		if err != nil {
+			t.Errorf("Expected the tracking table to be reconciled. Got %v", err)
+		}
+		if !lines.Contains("Deleted '" + removed + "'") {
+			t.Errorf("Expected the deletion to be logged. Got %v", lines)
+		}
+
+		err = migrator.Repair(db, edited, "2099-01-01 Nonexistent")
+		expectErrorContains(t, err, "neither applied nor supplied")
+	})
+}
+
+func TestRepairLeavesIDsAlone(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		migrations := []*Migration{
+			{ID: "2021-01-01 One", Script: "SELECT 1;"},
+			{ID: "2021-01-02 Two", Script: "SELECT 2;"},
+		}
+		err := migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{migrations[1].ID, migrations[0].ID}
+		err = migrator.Repair(db, migrations, ids...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids[0] != migrations[1].ID || ids[1] != migrations[0].ID {
+			t.Errorf("Expected the supplied IDs to be left in their order. Got %v", ids)
+		}
+	})
+}
+
+func TestRepairUnsupported(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		// The embedded Dialect hides the optional extensions of the real one
+		migrations := testMigrations(t, "useless-ansi")
+		migrator := makeTestMigrator(WithDialect(struct{ Dialect }{tdb.Dialect}))
+		err := migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = migrator.Repair(db, []*Migration{{ID: migrations[0].ID, Script: migrations[0].Script + "\n-- Edited"}})
+		if !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("Expected errors.ErrUnsupported. Got %v", err)
+		}
+		err = migrator.Repair(db, migrations[1:], migrations[0].ID)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("Expected errors.ErrUnsupported. Got %v", err)
+		}
+	})
+}
@@ -4,15 +4,30 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 // DefaultTableName defines the name of the database table which will
 // hold the status of applied migrations
 const DefaultTableName = "schema_migrations"
 
+// DefaultLockTableName defines the name of the database table which holds
+// the migration lock for databases without advisory locks, such as SQLite
+const DefaultLockTableName = "schema_migrations_lock"
+
 // ErrNilDB is thrown when the database pointer is nil
 var ErrNilDB = errors.New("DB pointer is nil")
 
+// ErrLockTimeout is returned (possibly wrapped) when the lock on the
+// migrations tracking table could not be obtained in time, usually because
+// another process is running migrations
+var ErrLockTimeout = errors.New("timed out waiting for the migration lock")
+
+// ErrLockLost is returned (wrapped) when a lease-based lock expired and was
+// taken over by another process while migrations were running
+var ErrLockLost = errors.New("the migration lock was lost")
+
 // DB  defines the interface for a *sql.DB, which can be used to get a concrete
 // connection to the database.
 type DB interface {
@@ -37,3 +52,61 @@ type Queryer interface {
 type Transactor interface {
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
+
+// queryScalar runs a query which returns a single value, and scans it into
+// dest. It returns sql.ErrNoRows if the query returns no rows.
+func queryScalar(ctx context.Context, tx Queryer, dest interface{}, query string, args ...interface{}) error {
+	found, err := queryRow(ctx, tx, query, args, dest)
+	if err == nil && !found {
+		err = sql.ErrNoRows
+	}
+	return err
+}
+
+// queryRow runs a query and scans the first row it returns into dest,
+// reporting whether there was such a row. The rows are closed before it
+// returns, so that the connection can be used for subsequent queries.
+func queryRow(ctx context.Context, tx Queryer, query string, args []interface{}, dest ...interface{}) (found bool, err error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer func() { err = coalesceErrs(err, rows.Close()) }()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	return true, rows.Scan(dest...)
+}
+
+// createTableIfNotExists creates a table of the package's own, such as the
+// lock table, from a column list which is portable between the built-in
+// dialects
+func createTableIfNotExists(ctx context.Context, tx Queryer, dialect Dialect, tableName, columns string) error {
+	if helper, ok := dialect.(HelperTables); ok {
+		return helper.CreateTableIfNotExists(ctx, tx, tableName, columns)
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s %s`, tableName, columns))
+	return err
+}
+
+// bindPlaceholders rewrites the ? placeholders in query into the form the
+// Dialect's driver expects
+func bindPlaceholders(dialect Dialect, query string) string {
+	helper, ok := dialect.(HelperTables)
+	if !ok {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString(helper.Placeholder(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
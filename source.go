@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+)
+
+// MigrationSource loads Migrations from wherever they are kept, such as a
+// directory, an embedded filesystem or code. Sources can be combined with
+// CompositeSource, and applied with Migrator.ApplySource.
+type MigrationSource interface {
+	Load(ctx context.Context) ([]*Migration, error)
+}
+
+// MigrationSourceFunc adapts an ordinary function into a MigrationSource,
+// for custom loaders
+type MigrationSourceFunc func(ctx context.Context) ([]*Migration, error)
+
+// Load implements the MigrationSource interface by calling f
+func (f MigrationSourceFunc) Load(ctx context.Context) ([]*Migration, error) {
+	return f(ctx)
+}
+
+// DirectorySource loads the .sql files in a directory on disk, as
+// MigrationsFromDirectoryPath does
+func DirectorySource(dirPath string) MigrationSource {
+	return MigrationSourceFunc(func(ctx context.Context) ([]*Migration, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return MigrationsFromDirectoryPath(dirPath)
+	})
+}
+
+// SliceSource supplies the provided Migrations, such as inline Migration
+// structs
+func SliceSource(migrations ...*Migration) MigrationSource {
+	return MigrationSourceFunc(func(ctx context.Context) ([]*Migration, error) {
+		return append(make([]*Migration, 0, len(migrations)), migrations...), nil
+	})
+}
+
+// CompositeSource combines the Migrations of several sources, loaded in the
+// order they are supplied. It fails if two of the Migrations share an ID.
+func CompositeSource(sources ...MigrationSource) MigrationSource {
+	return MigrationSourceFunc(func(ctx context.Context) ([]*Migration, error) {
+		migrations := make([]*Migration, 0)
+		ids := make(map[string]bool)
+		for _, source := range sources {
+			if err := ctx.Err(); err != nil {
+				return migrations, err
+			}
+			loaded, err := source.Load(ctx)
+			if err != nil {
+				return migrations, err
+			}
+			for _, migration := range loaded {
+				if ids[migration.ID] {
+					return migrations, fmt.Errorf("more than one source supplies the migration '%s'", migration.ID)
+				}
+				ids[migration.ID] = true
+			}
+			migrations = append(migrations, loaded...)
+		}
+		return migrations, nil
+	})
+}
+
+// ApplySource loads the Migrations from the supplied source, and applies
+// them as Apply does
+func (m *Migrator) ApplySource(db DB, source MigrationSource) error {
+	if db == nil {
+		return ErrNilDB
+	}
+	if m.ctx == nil {
+		m.ctx = context.Background()
+	}
+
+	migrations, err := source.Load(m.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	return m.Apply(db, migrations)
+}
@@ -0,0 +1,71 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCompositeSource(t *testing.T) {
+	inline := &Migration{ID: "2019-01-05 Inline", Script: "SELECT 1;"}
+	custom := MigrationSourceFunc(func(ctx context.Context) ([]*Migration, error) {
+		return []*Migration{{ID: "2019-01-06 Custom", Script: "SELECT 2;"}}, nil
+	})
+	source := CompositeSource(DirectorySource("test-migrations/saas"), SliceSource(inline), custom)
+
+	migrations, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortMigrations(migrations)
+	if len(migrations) != 4 {
+		t.Fatalf("Expected 4 migrations, got %d", len(migrations))
+	}
+	expectID(t, migrations[0], "2019-01-01 0900 Create Users")
+	expectID(t, migrations[2], "2019-01-05 Inline")
+	expectID(t, migrations[3], "2019-01-06 Custom")
+
+	_, err = CompositeSource(source, SliceSource(inline)).Load(context.Background())
+	expectErrorContains(t, err, "more than one source supplies the migration '2019-01-05 Inline'")
+
+	_, err = CompositeSource(DirectorySource("/a/nonexistent/path")).Load(context.Background())
+	expectErrorContains(t, err, "does not exist")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = source.Load(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestApplySource(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		err := migrator.ApplySource(db, CompositeSource(
+			DirectorySource("test-migrations/useless-ansi"),
+			SliceSource(&Migration{ID: "0000-00-00 003 Inline", Script: "SELECT 3;"}),
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != 3 {
+			t.Errorf("Expected 3 applied migrations, got %d", len(applied))
+		}
+
+		err = migrator.ApplySource(db, DirectorySource("/a/nonexistent/path"))
+		expectErrorContains(t, err, "failed to load migrations")
+
+		err = migrator.ApplySource(nil, SliceSource())
+		if err != ErrNilDB {
+			t.Errorf("Expected ErrNilDB, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,476 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Statement is a single executable unit of a migration's Script, as produced
+// by a StatementSplitter.
+type Statement struct {
+	// SQL is the text of the statement, without its terminator
+	SQL string
+
+	// Offset is the byte offset at which the statement begins within the
+	// Script it was split from
+	Offset int
+}
+
+// lexicalRules describes the parts of a dialect's syntax which determine
+// where one statement ends and the next one begins.
+type lexicalRules struct {
+	// backslashEscapes allows backslash escapes inside '...' and "..."
+	backslashEscapes bool
+
+	// escapeStrings enables E'...' strings, which allow backslash escapes
+	escapeStrings bool
+
+	// dollarQuotes enables $tag$...$tag$ strings
+	dollarQuotes bool
+
+	// backticks enables `...` quoted identifiers
+	backticks bool
+
+	// brackets enables [...] quoted identifiers
+	brackets bool
+
+	// hashComments enables # line comments
+	hashComments bool
+
+	// dashCommentNeedsSpace requires -- to be followed by whitespace to
+	// begin a line comment
+	dashCommentNeedsSpace bool
+
+	// nestedComments allows /* ... */ comments to nest
+	nestedComments bool
+
+	// delimiterCommand enables DELIMITER lines which change the statement
+	// terminator, as understood by the mysql client
+	delimiterCommand bool
+
+	// batchSeparator splits scripts only on GO lines, as understood by
+	// SQL Server's tools, instead of on semicolons. A GO line with a count
+	// repeats the preceding batch that many times.
+	batchSeparator bool
+
+	// blockBegins reports whether BEGIN, followed by the supplied upper-case
+	// word, opens a compound statement whose semicolons do not terminate
+	// the statement. A nil blockBegins disables compound statement tracking.
+	blockBegins func(next string) bool
+}
+
+// maxBatchRepeats is the largest count accepted on a GO line, which keeps a
+// mistyped count from exhausting memory
+const maxBatchRepeats = 10000
+
+// goLine matches a SQL Server batch separator line, capturing its optional
+// repeat count
+var goLine = regexp.MustCompile(`(?i)^\s*GO(?:\s+(\d+))?\s*(?:--.*)?$`)
+
+// scriptLexer is implemented by the built-in dialects to share the lexical
+// rules of their scripts with the rest of the package
+type scriptLexer interface {
+	scriptRules() lexicalRules
+}
+
+// statementSplitter holds the state of a single splitStatements call
+type statementSplitter struct {
+	lexicalRules
+
+	script     string
+	pos        int
+	start      int
+	hasContent bool
+	delimiter  string
+	depth      int
+	blocks     []string
+	statements []Statement
+	err        error
+}
+
+// splitStatements breaks script into statements according to the supplied
+// lexical rules. Comment-only and blank statements are omitted. It fails when
+// a GO line has an invalid repeat count.
+func splitStatements(script string, rules lexicalRules) ([]Statement, error) {
+	s := &statementSplitter{
+		lexicalRules: rules,
+		script:       script,
+		delimiter:    ";",
+		statements:   make([]Statement, 0),
+	}
+	s.split()
+	return s.statements, s.err
+}
+
+func (s *statementSplitter) split() {
+	for s.pos < len(s.script) && s.err == nil {
+		if s.atLineStart() && s.lineCommand() {
+			continue
+		}
+
+		c := s.script[s.pos]
+		switch {
+		case !s.batchSeparator && s.depth == 0 && len(s.blocks) == 0 && strings.HasPrefix(s.script[s.pos:], s.delimiter):
+			s.emit(s.pos)
+			s.pos += len(s.delimiter)
+			s.start = s.pos
+		case c == '\'':
+			s.skipQuoted('\'', s.backslashEscapes)
+		case c == '"':
+			s.skipQuoted('"', s.backslashEscapes)
+		case c == '`' && s.backticks:
+			s.skipQuoted('`', false)
+		case c == '[' && s.brackets:
+			s.skipQuoted(']', false)
+		case c == '-' && s.peek(1) == '-' && (!s.dashCommentNeedsSpace || s.pos+2 >= len(s.script) || isSpace(s.peek(2))):
+			s.skipLineComment()
+		case c == '#' && s.hashComments:
+			s.skipLineComment()
+		case c == '/' && s.peek(1) == '*':
+			s.skipBlockComment()
+		case c == '$' && s.dollarQuotes && s.skipDollarQuoted():
+			// The string was consumed by skipDollarQuoted
+		case isIdentStart(c):
+			s.word()
+		case isSpace(c):
+			s.pos++
+		default:
+			if c == '(' {
+				s.depth++
+			} else if c == ')' && s.depth > 0 {
+				s.depth--
+			}
+			s.hasContent = true
+			s.pos++
+		}
+	}
+	s.emit(len(s.script))
+}
+
+// emit records the text between the start of the current statement and end
+// as a Statement, provided it contains more than whitespace and comments.
+func (s *statementSplitter) emit(end int) {
+	if s.hasContent && end > s.start {
+		text := s.script[s.start:end]
+		trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+		s.statements = append(s.statements, Statement{
+			SQL:    strings.TrimRightFunc(trimmed, unicode.IsSpace),
+			Offset: s.start + len(text) - len(trimmed),
+		})
+	}
+	s.hasContent = false
+	s.depth = 0
+	s.blocks = s.blocks[:0]
+}
+
+// atLineStart reports whether the current position begins a new line
+func (s *statementSplitter) atLineStart() bool {
+	return s.pos == 0 || s.script[s.pos-1] == '\n'
+}
+
+// lineCommand consumes DELIMITER and GO lines, which are interpreted by
+// client tools rather than by the database. It returns false if the current
+// line isn't such a command.
+func (s *statementSplitter) lineCommand() bool {
+	end := strings.IndexByte(s.script[s.pos:], '\n')
+	if end < 0 {
+		end = len(s.script)
+	} else {
+		end += s.pos
+	}
+	line := s.script[s.pos:end]
+
+	switch {
+	case s.delimiterCommand:
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.EqualFold(fields[0], "DELIMITER") {
+			return false
+		}
+		s.emit(s.pos)
+		s.delimiter = fields[1]
+	case s.batchSeparator:
+		match := goLine.FindStringSubmatch(line)
+		if match == nil {
+			return false
+		}
+		batch := len(s.statements)
+		s.emit(s.pos)
+		if match[1] != "" {
+			// GO n executes the preceding batch n times
+			count, err := strconv.Atoi(match[1])
+			if err != nil || count < 1 || count > maxBatchRepeats {
+				s.err = fmt.Errorf("invalid count in %q: it must be between 1 and %d", strings.TrimSpace(line), maxBatchRepeats)
+				return true
+			}
+			for i := 1; i < count && len(s.statements) > batch; i++ {
+				s.statements = append(s.statements, s.statements[batch])
+			}
+		}
+	default:
+		return false
+	}
+
+	s.pos = end
+	s.start = end
+	return true
+}
+
+// minifyScript removes the comments from script according to the supplied
+// lexical rules, and drops the whitespace between the tokens of each line,
+// except for a single space between two words or two symbols, which might
+// otherwise run together into a different token. Line breaks, indentation,
+// strings, quoted identifiers and executable MySQL /*! ... */ comments are
+// kept.
+func minifyScript(script string, rules lexicalRules) string {
+	s := &statementSplitter{lexicalRules: rules, script: script, delimiter: ";"}
+	var minified strings.Builder
+	indenting := true  // nothing but whitespace precedes pos on its line
+	separated := false // whitespace or a comment precedes pos on its line
+	var previous byte  // the last byte written on the current line
+	for s.pos < len(s.script) {
+		start := s.pos
+		c := s.script[s.pos]
+		switch {
+		case c == '\n':
+			s.pos++
+			minified.WriteByte(c)
+			indenting, separated, previous = true, false, 0
+			continue
+		case isSpace(c):
+			s.pos++
+			if indenting {
+				minified.WriteByte(c)
+			} else {
+				separated = true
+			}
+			continue
+		case c == '-' && s.peek(1) == '-' && (!s.dashCommentNeedsSpace || s.pos+2 >= len(s.script) || isSpace(s.peek(2))),
+			c == '#' && s.hashComments:
+			s.skipLineComment()
+			indenting, separated = false, true
+			continue
+		case c == '/' && s.peek(1) == '*' && s.peek(2) != '!':
+			s.skipBlockComment()
+			indenting, separated = false, true
+			continue
+		case c == '\'':
+			s.skipQuoted('\'', s.backslashEscapes)
+		case c == '"':
+			s.skipQuoted('"', s.backslashEscapes)
+		case c == '`' && s.backticks:
+			s.skipQuoted('`', false)
+		case c == '[' && s.brackets:
+			s.skipQuoted(']', false)
+		case c == '$' && s.dollarQuotes && s.skipDollarQuoted():
+			// The string was consumed by skipDollarQuoted
+		case isIdentStart(c):
+			// Consumes E'...' strings along with the word
+			s.word()
+		default:
+			s.pos++
+		}
+
+		if separated && previous != 0 && isWordByte(previous) == isWordByte(c) {
+			minified.WriteByte(' ')
+		}
+		token := s.script[start:s.pos]
+		minified.WriteString(token)
+		indenting, separated, previous = false, false, token[len(token)-1]
+	}
+	return minified.String()
+}
+
+// skipQuoted consumes a string or quoted identifier which ends with the
+// closing character. A doubled closing character is an escaped one.
+func (s *statementSplitter) skipQuoted(closing byte, backslashEscapes bool) {
+	s.hasContent = true
+	s.pos++
+	for s.pos < len(s.script) {
+		c := s.script[s.pos]
+		switch {
+		case backslashEscapes && c == '\\':
+			s.pos += 2
+		case c == closing && s.peek(1) == closing:
+			s.pos += 2
+		case c == closing:
+			s.pos++
+			return
+		default:
+			s.pos++
+		}
+	}
+	s.pos = len(s.script)
+}
+
+// skipLineComment consumes a comment up to (but not including) the end of
+// the line
+func (s *statementSplitter) skipLineComment() {
+	end := strings.IndexByte(s.script[s.pos:], '\n')
+	if end < 0 {
+		s.pos = len(s.script)
+		return
+	}
+	s.pos += end
+}
+
+// skipBlockComment consumes a /* ... */ comment
+func (s *statementSplitter) skipBlockComment() {
+	if s.peek(2) == '!' {
+		// MySQL's /*! ... */ comments contain executable SQL
+		s.hasContent = true
+	}
+	s.pos += 2
+	depth := 1
+	for s.pos < len(s.script) && depth > 0 {
+		switch {
+		case s.nestedComments && s.script[s.pos] == '/' && s.peek(1) == '*':
+			depth++
+			s.pos += 2
+		case s.script[s.pos] == '*' && s.peek(1) == '/':
+			depth--
+			s.pos += 2
+		default:
+			s.pos++
+		}
+	}
+	if s.pos > len(s.script) {
+		s.pos = len(s.script)
+	}
+}
+
+// skipDollarQuoted consumes a $tag$ ... $tag$ string. It returns false,
+// without consuming anything, if the current $ doesn't open such a string
+// (for example, when it is a $1 parameter placeholder).
+func (s *statementSplitter) skipDollarQuoted() bool {
+	if s.pos > 0 && isIdentChar(s.script[s.pos-1]) {
+		return false
+	}
+
+	end := s.pos + 1
+	for end < len(s.script) && s.script[end] != '$' {
+		c := s.script[end]
+		if !isIdentChar(c) || (end == s.pos+1 && c >= '0' && c <= '9') {
+			return false
+		}
+		end++
+	}
+	if end >= len(s.script) {
+		return false
+	}
+
+	tag := s.script[s.pos : end+1]
+	closing := strings.Index(s.script[end+1:], tag)
+	if closing < 0 {
+		s.pos = len(s.script)
+	} else {
+		s.pos = end + 1 + closing + len(tag)
+	}
+	s.hasContent = true
+	return true
+}
+
+// word consumes a keyword or identifier, keeping track of the compound
+// statements it opens and closes.
+func (s *statementSplitter) word() {
+	start := s.pos
+	for s.pos < len(s.script) && isIdentChar(s.script[s.pos]) {
+		if s.delimiter != ";" && strings.HasPrefix(s.script[s.pos:], s.delimiter) {
+			break
+		}
+		s.pos++
+	}
+	s.hasContent = true
+	w := strings.ToUpper(s.script[start:s.pos])
+
+	if s.escapeStrings && w == "E" && s.peek(0) == '\'' {
+		s.skipQuoted('\'', true)
+		return
+	}
+
+	if s.blockBegins == nil || s.delimiter != ";" {
+		return
+	}
+
+	switch w {
+	case "BEGIN":
+		if s.blockBegins(s.nextWord()) {
+			s.blocks = append(s.blocks, w)
+		}
+	case "CASE":
+		if len(s.blocks) > 0 {
+			s.blocks = append(s.blocks, w)
+		}
+	case "END":
+		if len(s.blocks) == 0 {
+			return
+		}
+		switch s.nextWord() {
+		case "IF", "LOOP", "WHILE", "REPEAT":
+			// These close statements which were never opened on the stack
+			s.skipNextWord()
+		case "CASE":
+			s.blocks = s.blocks[:len(s.blocks)-1]
+			s.skipNextWord()
+		default:
+			s.blocks = s.blocks[:len(s.blocks)-1]
+		}
+	}
+}
+
+// nextWord returns the upper-cased word following the current position,
+// skipping whitespace. It returns an empty string if the next non-whitespace
+// character doesn't begin a word.
+func (s *statementSplitter) nextWord() string {
+	start := s.pos
+	for start < len(s.script) && isSpace(s.script[start]) {
+		start++
+	}
+	end := start
+	for end < len(s.script) && isIdentChar(s.script[end]) {
+		end++
+	}
+	if end == start || !isIdentStart(s.script[start]) {
+		return ""
+	}
+	return strings.ToUpper(s.script[start:end])
+}
+
+// skipNextWord consumes the whitespace and word returned by nextWord
+func (s *statementSplitter) skipNextWord() {
+	for s.pos < len(s.script) && isSpace(s.script[s.pos]) {
+		s.pos++
+	}
+	for s.pos < len(s.script) && isIdentChar(s.script[s.pos]) {
+		s.pos++
+	}
+}
+
+// peek returns the byte at the supplied distance from the current position,
+// or 0 past the end of the script
+func (s *statementSplitter) peek(distance int) byte {
+	if s.pos+distance >= len(s.script) {
+		return 0
+	}
+	return s.script[s.pos+distance]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// isWordByte reports whether c belongs to a word, number, string or quoted
+// identifier, rather than to an operator or punctuation
+func isWordByte(c byte) bool {
+	return isIdentChar(c) || c == '.' || c == '\'' || c == '"' || c == '`' || c == '[' || c == ']'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '$' || (c >= '0' && c <= '9')
+}
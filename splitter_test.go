@@ -0,0 +1,205 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Interface verification that the built-in dialects split statements
+var (
+	_ StatementSplitter = Postgres
+	_ StatementSplitter = MySQL
+	_ StatementSplitter = SQLite
+	_ StatementSplitter = MSSQL
+)
+
+type splitterTest struct {
+	name     string
+	script   string
+	expected []string
+}
+
+func runSplitterTests(t *testing.T, rules lexicalRules, tests []splitterTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statements, err := splitStatements(test.script, rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := make([]string, 0, len(statements))
+			for _, statement := range statements {
+				actual = append(actual, statement.SQL)
+				if !strings.HasPrefix(test.script[statement.Offset:], statement.SQL) {
+					t.Errorf("Offset %d doesn't point at statement %q", statement.Offset, statement.SQL)
+				}
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("Expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSplitStatementsCommon(t *testing.T) {
+	for name, rules := range map[string]lexicalRules{
+		"postgres": postgresLexicalRules,
+		"mysql":    mysqlLexicalRules,
+		"sqlite":   sqliteLexicalRules,
+	} {
+		t.Run(name, func(t *testing.T) {
+			runSplitterTests(t, rules, []splitterTest{
+				{"Empty", "", []string{}},
+				{"Single", "SELECT 1", []string{"SELECT 1"}},
+				{"Terminated", "SELECT 1;", []string{"SELECT 1"}},
+				{"Multiple", "SELECT 1;\nSELECT 2;\n", []string{"SELECT 1", "SELECT 2"}},
+				{"SemicolonInString", "INSERT INTO t VALUES ('a;b');SELECT 2", []string{"INSERT INTO t VALUES ('a;b')", "SELECT 2"}},
+				{"DoubledQuote", "SELECT 'it''s;';SELECT 2", []string{"SELECT 'it''s;'", "SELECT 2"}},
+				{"SemicolonInIdentifier", `SELECT "a;b" FROM t;SELECT 2`, []string{`SELECT "a;b" FROM t`, "SELECT 2"}},
+				{"LineComment", "-- drop; everything\nSELECT 1;", []string{"-- drop; everything\nSELECT 1"}},
+				{"BlockComment", "SELECT /* ; */ 1;SELECT 2", []string{"SELECT /* ; */ 1", "SELECT 2"}},
+				{"CommentOnly", "SELECT 1;\n-- trailing comment\n", []string{"SELECT 1"}},
+				{"BlankStatements", ";;SELECT 1;;", []string{"SELECT 1"}},
+				{"Parentheses", "CREATE RULE r AS ON INSERT TO t DO ALSO (SELECT 1; SELECT 2);", []string{"CREATE RULE r AS ON INSERT TO t DO ALSO (SELECT 1; SELECT 2)"}},
+				{"UnterminatedString", "SELECT 'abc;", []string{"SELECT 'abc;"}},
+			})
+		})
+	}
+}
+
+func TestSplitStatementsPostgres(t *testing.T) {
+	runSplitterTests(t, postgresLexicalRules, []splitterTest{
+		{
+			"DollarQuotes",
+			"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql;\nSELECT f();",
+			[]string{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql", "SELECT f()"},
+		},
+		{
+			"TaggedDollarQuotes",
+			"DO $body$ BEGIN PERFORM '$$;'; END $body$;SELECT 2",
+			[]string{"DO $body$ BEGIN PERFORM '$$;'; END $body$", "SELECT 2"},
+		},
+		{"Placeholders", "PREPARE p AS SELECT $1;EXECUTE p(1)", []string{"PREPARE p AS SELECT $1", "EXECUTE p(1)"}},
+		{"EscapeStrings", `SELECT E'it\'s;';SELECT 2`, []string{`SELECT E'it\'s;'`, "SELECT 2"}},
+		{"StandardStrings", `SELECT 'C:\';SELECT 2`, []string{`SELECT 'C:\'`, "SELECT 2"}},
+		{"NestedComments", "SELECT /* a /* b; */ c; */ 1;SELECT 2", []string{"SELECT /* a /* b; */ c; */ 1", "SELECT 2"}},
+		{
+			"BeginAtomic",
+			"CREATE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END;\nSELECT f();",
+			[]string{"CREATE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END", "SELECT f()"},
+		},
+		{"Transaction", "BEGIN;SELECT 1;END;", []string{"BEGIN", "SELECT 1", "END"}},
+	})
+}
+
+func TestSplitStatementsMySQL(t *testing.T) {
+	runSplitterTests(t, mysqlLexicalRules, []splitterTest{
+		{"BackslashEscapes", `SELECT 'it\'s;';SELECT "a\";";SELECT 3`, []string{`SELECT 'it\'s;'`, `SELECT "a\";"`, "SELECT 3"}},
+		{"Backticks", "SELECT `a;b` FROM t;SELECT 2", []string{"SELECT `a;b` FROM t", "SELECT 2"}},
+		{"HashComments", "# comment;\nSELECT 1;", []string{"# comment;\nSELECT 1"}},
+		{"DashWithoutSpace", "SELECT 1--1;SELECT 2", []string{"SELECT 1--1", "SELECT 2"}},
+		{"ExecutableComment", "/*!40101 SET NAMES utf8 */;SELECT 1", []string{"/*!40101 SET NAMES utf8 */", "SELECT 1"}},
+		{
+			"Delimiter",
+			"DELIMITER $$\nCREATE PROCEDURE p() BEGIN SELECT 1; END$$\nDELIMITER ;\nCALL p();",
+			[]string{"CREATE PROCEDURE p() BEGIN SELECT 1; END", "CALL p()"},
+		},
+		{
+			"DelimiterSlashes",
+			"DELIMITER //\nCREATE TRIGGER t BEFORE INSERT ON x FOR EACH ROW SET NEW.a = 1; //\nDELIMITER ;\nSELECT 1",
+			[]string{"CREATE TRIGGER t BEFORE INSERT ON x FOR EACH ROW SET NEW.a = 1;", "SELECT 1"},
+		},
+		{
+			"CompoundStatement",
+			"CREATE PROCEDURE p()\nBEGIN\n  IF 1 THEN SELECT 1; END IF;\n  CASE WHEN 1 THEN SELECT 2; END CASE;\n  lbl: LOOP LEAVE lbl; END LOOP;\nEND;\nCALL p();",
+			[]string{"CREATE PROCEDURE p()\nBEGIN\n  IF 1 THEN SELECT 1; END IF;\n  CASE WHEN 1 THEN SELECT 2; END CASE;\n  lbl: LOOP LEAVE lbl; END LOOP;\nEND", "CALL p()"},
+		},
+		{"Transaction", "BEGIN;SELECT 1;COMMIT;", []string{"BEGIN", "SELECT 1", "COMMIT"}},
+		{"BeginWork", "BEGIN WORK;SELECT 1", []string{"BEGIN WORK", "SELECT 1"}},
+	})
+}
+
+func TestSplitStatementsSQLite(t *testing.T) {
+	runSplitterTests(t, sqliteLexicalRules, []splitterTest{
+		{"Brackets", "SELECT [a;b] FROM t;SELECT 2", []string{"SELECT [a;b] FROM t", "SELECT 2"}},
+		{
+			"Trigger",
+			"CREATE TRIGGER t AFTER INSERT ON x BEGIN\n  UPDATE y SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n  DELETE FROM z;\nEND;\nSELECT 1;",
+			[]string{"CREATE TRIGGER t AFTER INSERT ON x BEGIN\n  UPDATE y SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n  DELETE FROM z;\nEND", "SELECT 1"},
+		},
+		{"Transaction", "BEGIN IMMEDIATE;SELECT 1;END TRANSACTION;", []string{"BEGIN IMMEDIATE", "SELECT 1", "END TRANSACTION"}},
+	})
+}
+
+func TestSplitStatementsMSSQL(t *testing.T) {
+	runSplitterTests(t, mssqlLexicalRules, []splitterTest{
+		{"NoSeparators", "SELECT 1; SELECT 2;", []string{"SELECT 1; SELECT 2;"}},
+		{
+			"Batches",
+			"CREATE TABLE t (id int);\nGO\nCREATE PROCEDURE p AS SELECT 1;\ngo -- end of procedure\r\nEXEC p;",
+			[]string{"CREATE TABLE t (id int);", "CREATE PROCEDURE p AS SELECT 1;", "EXEC p;"},
+		},
+		{"GoInString", "SELECT '\nGO\n';", []string{"SELECT '\nGO\n';"}},
+		{"GoInComment", "/*\nGO\n*/ SELECT 1;", []string{"/*\nGO\n*/ SELECT 1;"}},
+		{"GoInIdentifier", "SELECT 1 AS [\nGO\n];", []string{"SELECT 1 AS [\nGO\n];"}},
+		{"NotGo", "SELECT 1\nGOTO label\n", []string{"SELECT 1\nGOTO label"}},
+		{"EmptyBatches", "GO\nGO\nSELECT 1\nGO\n", []string{"SELECT 1"}},
+		{"RepeatCount", "INSERT INTO t DEFAULT VALUES\nGO 3\nSELECT 1", []string{"INSERT INTO t DEFAULT VALUES", "INSERT INTO t DEFAULT VALUES", "INSERT INTO t DEFAULT VALUES", "SELECT 1"}},
+		{"RepeatEmptyBatch", "GO 5\nSELECT 1\nGO 1", []string{"SELECT 1"}},
+	})
+}
+
+func TestSplitStatementsMSSQLInvalidCount(t *testing.T) {
+	tests := map[string]string{
+		"NotANumber": "SELECT 1\nGO 99999999999999999999\n",
+		"Zero":       "SELECT 1\nGO 0\n",
+		"TooLarge":   "SELECT 1\nGO 99999999999\n",
+	}
+	for name, script := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := splitStatements(script, mssqlLexicalRules)
+			expectErrorContains(t, err, "must be between 1 and 10000")
+		})
+	}
+
+	statements, err := splitStatements("SELECT 1\nGO 10000\n", mssqlLexicalRules)
+	if err != nil || len(statements) != maxBatchRepeats {
+		t.Errorf("Expected %d statements. Got %d, %v", maxBatchRepeats, len(statements), err)
+	}
+}
+
+func TestApplyReportsFailingStatement(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		if _, isSplitter := tdb.Dialect.(StatementSplitter); !isSplitter {
+			t.Skipf("%s doesn't split statements", tdb.Driver)
+		}
+
+		tableName := fmt.Sprintf("split_test_%d", time.Now().UnixNano())
+		err := migrator.Apply(db, []*Migration{{
+			ID:     "2024-01-01 Split",
+			Script: "CREATE TABLE " + tableName + " (id INTEGER);\nINSERT INTO " + tableName + " (id) VALUES (1);\nINSERT INTO nonexistent_table (id) VALUES (1);",
+		}})
+		expectErrorContains(t, err, "statement 3 of 3")
+		expectErrorContains(t, err, "nonexistent_table")
+
+		var migrationErr *MigrationError
+		if !errors.As(err, &migrationErr) {
+			t.Fatalf("Expected a *MigrationError. Got %v", err)
+		}
+		if migrationErr.StatementIndex != 2 || migrationErr.StatementCount != 3 {
+			t.Errorf("Expected statement 3 of 3 to fail. Got %d of %d", migrationErr.StatementIndex+1, migrationErr.StatementCount)
+		}
+		script := migrationErr.Migration.Script
+		if !strings.HasPrefix(script[migrationErr.Offset:], "INSERT INTO nonexistent_table") {
+			t.Errorf("Expected Offset to point at the failing statement. Got %d", migrationErr.Offset)
+		}
+	})
+}
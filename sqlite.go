@@ -2,8 +2,10 @@ package schema
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 )
@@ -11,7 +13,128 @@ import (
 // SQLite is the dialect for sqlite3 databases
 var SQLite = &sqliteDialect{}
 
-type sqliteDialect struct{}
+var (
+	// sqliteLockTTL is how long a lock row is honored without being renewed.
+	// It only matters when a process dies without releasing its lock: after
+	// it expires, the lock can be taken over by another process.
+	sqliteLockTTL = DefaultLeaseTTL
+
+	// sqliteHeartbeatInterval is how often a held lock row is renewed
+	sqliteHeartbeatInterval = DefaultHeartbeatInterval
+)
+
+// sqliteLocks remembers the lease behind each lock obtained by the SQLite
+// dialect, keyed by the connection which obtained it, so that Unlock only
+// deletes its own lock row and stops its heartbeat
+var sqliteLocks sync.Map
+
+type sqliteDialect struct {
+	// lockNamespace is the namespace supplied to KeyedLocker
+	lockNamespace string
+}
+
+// Lock implements the Locker interface. SQLite has no advisory locks, so a
+// row is inserted into the DefaultLockTableName table instead, in the same
+// format used by LeaseLocker. Lock waits until no other process holds that
+// row. A database which is busy for any other reason, such as a long-running
+// read on another connection, fails with the driver's "database is locked"
+// error once its busy timeout expires.
+//
+// Like a LeaseLocker's lease, the row is renewed by a heartbeat while it is
+// held. The renewals use the connection which obtained the lock, so that a
+// database limited to one connection can still be migrated. While a
+// transaction is open on that connection, as it is for the whole of
+// TransactionModeAllInOne, the renewals become part of it. SQLite's
+// database-wide write lock keeps other processes from taking the row over
+// until the transaction ends. If it rolls back, so do the renewals, and a
+// row which has expired as a result may be taken over before it is renewed
+// again. Unlock reports that takeover as ErrLockLost.
+func (s sqliteDialect) Lock(ctx context.Context, tx Queryer, tableName string) error {
+	return s.LockWithTimeout(ctx, tx, tableName, -1)
+}
+
+// LockWithTimeout implements the TimeoutLocker interface by polling for the
+// lock row until it is obtained or the timeout expires.
+func (s sqliteDialect) LockWithTimeout(ctx context.Context, tx Queryer, tableName string, timeout time.Duration) error {
+	table := newLeaseTable(&s, DefaultLockTableName)
+	holderID := newLockHolderID()
+	err := pollLock(ctx, timeout, func() (bool, error) {
+		acquired, err := table.tryAcquire(ctx, tx, s.lockName(tableName), holderID, sqliteLockTTL)
+		if isSQLiteBusy(err) {
+			// Another connection is writing. Keep waiting if it may be the
+			// holder of the lock, running its migrations. Otherwise the
+			// driver has already retried for its busy timeout, so the error
+			// is returned.
+			holder, holderErr := table.holder(ctx, tx, s.lockName(tableName))
+			if holderErr == nil && holder != "" && holder != holderID {
+				return false, nil
+			}
+		}
+		return acquired, err
+	})
+	if errors.Is(err, ErrLockTimeout) {
+		return fmt.Errorf("%w: %s is locked by another process", err, tableName)
+	}
+	if err != nil {
+		return err
+	}
+
+	held := newLease(holderID)
+	sqliteLocks.Store(tx, held)
+	go held.heartbeat(sqliteHeartbeatInterval, func() (bool, error) {
+		// Failures, such as SQLITE_BUSY while another connection writes, are
+		// retried by the next heartbeat
+		return table.renew(ctx, tx, s.lockName(tableName), holderID, sqliteLockTTL)
+	})
+	return nil
+}
+
+// Unlock implements the Locker interface by stopping the heartbeat and
+// deleting the lock row inserted by Lock. It returns ErrLockLost if the lock
+// expired and was taken over by another process while it was held, including
+// when a heartbeat's renewal was rolled back with a transaction.
+func (s sqliteDialect) Unlock(ctx context.Context, tx Queryer, tableName string) error {
+	value, locked := sqliteLocks.LoadAndDelete(tx)
+	if !locked {
+		return nil
+	}
+	held := value.(*lease)
+	lost := held.stopHeartbeat()
+	released, err := newLeaseTable(&s, DefaultLockTableName).release(ctx, tx, s.lockName(tableName), held.holderID)
+	if err == nil && (lost || !released) {
+		err = fmt.Errorf("%w: the lock on %s expired while it was held", ErrLockLost, tableName)
+	}
+	return err
+}
+
+// LockStatus implements the LockInspector interface by reading the lock row
+func (s sqliteDialect) LockStatus(ctx context.Context, tx Queryer, tableName string) (*LockStatus, error) {
+	return newLeaseTable(&s, DefaultLockTableName).status(ctx, tx, s.lockName(tableName))
+}
+
+// KeyedLocker implements the LockKeyer interface. The lock row is named
+// after the namespace and the tracking table.
+func (s sqliteDialect) KeyedLocker(namespace string) Locker {
+	return &sqliteDialect{lockNamespace: namespace}
+}
+
+// lockName returns the name of the lock row for tableName
+func (s sqliteDialect) lockName(tableName string) string {
+	if s.lockNamespace == "" {
+		return tableName
+	}
+	return namespacedLockName(s.lockNamespace, tableName, leaseNameLength)
+}
+
+// isSQLiteBusy reports whether err was caused by another connection holding
+// a conflicting lock on the database file
+func isSQLiteBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked") || strings.Contains(msg, "SQLITE_BUSY")
+}
 
 // CreateMigrationsTable implements the Dialect interface to create the
 // table which tracks applied migrations. It only creates the table if it
@@ -39,7 +162,7 @@ func (s *sqliteDialect) InsertAppliedMigration(ctx context.Context, tx Queryer,
 		( ?, ?, ?, ? )
 		`, tableName,
 	)
-	_, err := tx.ExecContext(ctx, query, am.ID, am.MD5(), am.ExecutionTimeInMillis, am.AppliedAt)
+	_, err := tx.ExecContext(ctx, query, am.ID, am.checksum(), am.ExecutionTimeInMillis, am.AppliedAt)
 	return err
 }
 
@@ -72,6 +195,140 @@ func (s sqliteDialect) GetAppliedMigrations(ctx context.Context, tx Queryer, tab
 	return migrations, err
 }
 
+// UpgradeMigrationsTable implements the MigrationsTableUpgrader interface to
+// bring the tracking table up to the supplied version of its structure
+func (s sqliteDialect) UpgradeMigrationsTable(ctx context.Context, tx Queryer, tableName string, version int) error {
+	switch version {
+	case 2:
+		// SQLite's TEXT columns have no length to widen
+		return nil
+	default:
+		return fmt.Errorf("no upgrade to version %d of the tracking table", version)
+	}
+}
+
+// UpdateChecksum implements the ChecksumUpdater interface to replace the
+// checksum recorded for an applied migration
+func (s sqliteDialect) UpdateChecksum(ctx context.Context, tx Queryer, tableName, id, checksum string) error {
+	query := fmt.Sprintf(`UPDATE %s SET checksum = ? WHERE id = ?`, tableName)
+	_, err := tx.ExecContext(ctx, query, checksum, id)
+	return err
+}
+
+// DeleteAppliedMigration implements the AppliedMigrationDeleter interface to
+// remove the tracking table row of an applied migration
+func (s sqliteDialect) DeleteAppliedMigration(ctx context.Context, tx Queryer, tableName, id string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, tableName)
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+// ExtendMigrationsTable implements the ExtendedTracker interface to add the
+// extended tracking columns to the tracking table. SQLite lacks ADD COLUMN IF
+// NOT EXISTS, so the table is checked for the columns first.
+func (s sqliteDialect) ExtendMigrationsTable(ctx context.Context, tx Queryer, tableName string) error {
+	_, err := queryRow(ctx, tx, fmt.Sprintf(`SELECT applied_by FROM %s LIMIT 0`, tableName), nil)
+	if err == nil {
+		return nil
+	}
+
+	// SQLite only adds one column per ALTER TABLE
+	for _, column := range []string{
+		`applied_by TEXT NOT NULL DEFAULT ''`,
+		`hostname TEXT NOT NULL DEFAULT ''`,
+		`app_version TEXT NOT NULL DEFAULT ''`,
+		`script TEXT`,
+	} {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s`, tableName, column))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertExtendedAppliedMigration implements the ExtendedTracker interface to
+// insert a record, including the extended columns, into the migrations
+// tracking table *after* a migration has successfully run.
+func (s sqliteDialect) InsertExtendedAppliedMigration(ctx context.Context, tx Queryer, tableName string, am *AppliedMigration) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s
+		( id, checksum, execution_time_in_millis, applied_at, applied_by, hostname, app_version, script )
+		VALUES
+		( ?, ?, ?, ?, ?, ?, ?, ? )
+		`, tableName,
+	)
+	_, err := tx.ExecContext(ctx, query, am.ID, am.checksum(), am.ExecutionTimeInMillis, am.AppliedAt, am.AppliedBy, am.Hostname, am.AppVersion, am.Script)
+	return err
+}
+
+// GetExtendedAppliedMigrations implements the ExtendedTracker interface to
+// retrieve all data, including the extended columns, from the migrations
+// tracking table
+func (s sqliteDialect) GetExtendedAppliedMigrations(ctx context.Context, tx Queryer, tableName string) (migrations []*AppliedMigration, err error) {
+	migrations = make([]*AppliedMigration, 0)
+
+	query := fmt.Sprintf(`
+		SELECT id, checksum, execution_time_in_millis, applied_at, applied_by, hostname, app_version, COALESCE(script, '')
+		FROM %s
+		ORDER BY id ASC
+	`, tableName)
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return migrations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		migration := AppliedMigration{}
+		err = rows.Scan(&migration.ID, &migration.Checksum, &migration.ExecutionTimeInMillis, &migration.AppliedAt, &migration.AppliedBy, &migration.Hostname, &migration.AppVersion, &migration.Script)
+		if err != nil {
+			err = fmt.Errorf("Failed to GetExtendedAppliedMigrations. Did somebody change the structure of the %s table?: %w", tableName, err)
+			return migrations, err
+		}
+		migration.AppliedAt = migration.AppliedAt.In(time.Local)
+		migrations = append(migrations, &migration)
+	}
+
+	return migrations, err
+}
+
+// sqliteLexicalRules describe how SQLite scripts are split into statements.
+// The BEGIN ... END bodies of triggers are kept intact.
+var sqliteLexicalRules = lexicalRules{
+	backticks: true,
+	brackets:  true,
+	blockBegins: func(next string) bool {
+		switch next {
+		case "", "DEFERRED", "IMMEDIATE", "EXCLUSIVE", "TRANSACTION":
+			// These begin transactions rather than trigger bodies
+			return false
+		}
+		return true
+	},
+}
+
+// SplitStatements breaks a SQLite script into individual statements
+func (s sqliteDialect) SplitStatements(script string) ([]Statement, error) {
+	return splitStatements(script, sqliteLexicalRules)
+}
+
+// scriptRules returns the lexical rules of SQLite scripts
+func (s sqliteDialect) scriptRules() lexicalRules {
+	return sqliteLexicalRules
+}
+
+// CreateTableIfNotExists implements the HelperTables interface
+func (s sqliteDialect) CreateTableIfNotExists(ctx context.Context, tx Queryer, tableName, columns string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s %s`, tableName, columns))
+	return err
+}
+
+// Placeholder implements the HelperTables interface
+func (s sqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
 // QuotedTableName returns the string value of the name of the migration
 // tracking table after it has been quoted for SQLite
 func (s sqliteDialect) QuotedTableName(schemaName, tableName string) string {
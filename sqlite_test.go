@@ -1,7 +1,12 @@
 package schema
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	// SQLite driver
 	_ "github.com/mattn/go-sqlite3"
@@ -9,7 +14,17 @@ import (
 
 // Interface verification that SQLite is a valid Dialect
 var (
-	_ Dialect = SQLite
+	_ Dialect       = SQLite
+	_ Locker        = SQLite
+	_ TimeoutLocker = SQLite
+	_ LockInspector = SQLite
+	_ LockKeyer     = SQLite
+
+	_ ExtendedTracker         = SQLite
+	_ MigrationsTableUpgrader = SQLite
+	_ ChecksumUpdater         = SQLite
+	_ AppliedMigrationDeleter = SQLite
+	_ HelperTables            = SQLite
 )
 
 func TestSQLiteQuotedTableName(t *testing.T) {
@@ -32,3 +47,282 @@ func TestSQLiteQuotedTableName(t *testing.T) {
 		}
 	}
 }
+
+// TestSQLiteLock ensures that only one connection at a time can hold the
+// lock row for a tracking table
+func TestSQLiteLock(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		tableName := makeTestMigrator(WithDialect(SQLite)).QuotedTableName()
+		holder, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = holder.Close() }()
+		waiter, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = waiter.Close() }()
+
+		err = SQLite.Lock(ctx, holder, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = SQLite.LockWithTimeout(ctx, waiter, tableName, 100*time.Millisecond)
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected ErrLockTimeout while the lock is held. Got %v", err)
+		}
+
+		err = SQLite.Unlock(ctx, holder, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = SQLite.LockWithTimeout(ctx, waiter, tableName, 100*time.Millisecond)
+		if err != nil {
+			t.Errorf("Expected the released lock to be obtained. Got %v", err)
+		}
+		_ = SQLite.Unlock(ctx, waiter, tableName)
+	})
+}
+
+// TestSQLiteLockTakesOverExpiredLock ensures that a lock row abandoned by a
+// crashed process doesn't block migrations forever
+func TestSQLiteLockTakesOverExpiredLock(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		tableName := makeTestMigrator(WithDialect(SQLite)).QuotedTableName()
+		err := SQLite.Lock(ctx, db, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(fmt.Sprintf(
+			`UPDATE %s SET holder_id = 'crashed', expires_at = 0 WHERE lock_name = ?`,
+			SQLite.QuotedTableName("", DefaultLockTableName),
+		), tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = SQLite.LockWithTimeout(ctx, db, tableName, 100*time.Millisecond)
+		if err != nil {
+			t.Errorf("Expected the expired lock to be taken over. Got %v", err)
+		}
+		_ = SQLite.Unlock(ctx, db, tableName)
+	})
+}
+
+// TestSQLiteLockReturnsOtherBusyErrors ensures that a database kept busy by
+// something other than the holder of the lock, such as an open read cursor,
+// fails the lock instead of being waited on forever
+func TestSQLiteLockReturnsOtherBusyErrors(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		reader := tdb.Connect(t)
+		defer func() { _ = reader.Close() }()
+		db, err := sql.Open(tdb.Driver, tdb.DSN()+"?_busy_timeout=50")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = db.Close() }()
+
+		_, err = reader.Exec(`CREATE TABLE IF NOT EXISTS busy_readers (x INTEGER); INSERT INTO busy_readers VALUES (1), (2)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := reader.Query(`SELECT x FROM busy_readers`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = rows.Close() }()
+		rows.Next()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		migrator := makeTestMigrator(WithDialect(SQLite), WithContext(ctx))
+		err = migrator.Apply(db, testMigrations(t, "useless-ansi"))
+		if !isSQLiteBusy(err) || errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the busy error to be returned. Got %v", err)
+		}
+	})
+}
+
+func TestIsSQLiteBusy(t *testing.T) {
+	if isSQLiteBusy(nil) {
+		t.Error("Expected nil not to be busy")
+	}
+	if !isSQLiteBusy(errors.New("database is locked")) {
+		t.Error("Expected 'database is locked' to be busy")
+	}
+	if isSQLiteBusy(errors.New("no such table: users")) {
+		t.Error("Expected other errors not to be busy")
+	}
+}
+
+func TestSQLiteLockStatus(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		migrator := makeTestMigrator(WithDialect(SQLite))
+		status, err := migrator.LockStatus(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Held {
+			t.Errorf("Expected the lock not to be held. Got %+v", status)
+		}
+
+		err = SQLite.Lock(ctx, db, migrator.QuotedTableName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, err = migrator.LockStatus(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Held || status.Holder == "" || status.Host != localHostname {
+			t.Errorf("Expected the lock to be held by this process. Got %+v", status)
+		}
+		if !status.ExpiresAt.After(status.Since) {
+			t.Errorf("Expected the lock to expire after it was acquired. Got %+v", status)
+		}
+		_ = SQLite.Unlock(ctx, db, migrator.QuotedTableName())
+	})
+}
+
+// TestSQLiteLockHeartbeat ensures that a lock held for longer than its TTL
+// isn't taken over, even while migrations run on the locked connection
+func TestSQLiteLockHeartbeat(t *testing.T) {
+	defer func(ttl, interval time.Duration) {
+		sqliteLockTTL, sqliteHeartbeatInterval = ttl, interval
+	}(sqliteLockTTL, sqliteHeartbeatInterval)
+	sqliteLockTTL, sqliteHeartbeatInterval = 200*time.Millisecond, 20*time.Millisecond
+
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		tableName := makeTestMigrator(WithDialect(SQLite)).QuotedTableName()
+		holder, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = holder.Close() }()
+
+		err = SQLite.Lock(ctx, holder, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * sqliteLockTTL)
+		err = SQLite.LockWithTimeout(ctx, db, tableName, 50*time.Millisecond)
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("Expected the renewed lock to still be held. Got %v", err)
+		}
+		err = SQLite.Unlock(ctx, holder, tableName)
+		if err != nil {
+			t.Error(err)
+		}
+
+		// A lock which was taken over is reported as lost
+		err = SQLite.Lock(ctx, holder, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(fmt.Sprintf(
+			`UPDATE %s SET holder_id = 'usurper' WHERE lock_name = ?`,
+			SQLite.QuotedTableName("", DefaultLockTableName),
+		), tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * sqliteHeartbeatInterval)
+		err = SQLite.Unlock(ctx, holder, tableName)
+		if !errors.Is(err, ErrLockLost) {
+			t.Errorf("Expected ErrLockLost. Got %v", err)
+		}
+
+		// Heartbeats interleave with migrations on the locked connection
+		migrations := make([]*Migration, 0)
+		for i := 0; i < 50; i++ {
+			migrations = append(migrations, &Migration{ID: fmt.Sprintf("2021-01-01 %03d", i), Script: "SELECT 1;"})
+		}
+		err = makeTestMigrator(WithDialect(SQLite), WithTransactionMode(PerMigration)).Apply(db, migrations)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestSQLiteLockRenewalRolledBack ensures that a renewal made inside a
+// transaction which is rolled back doesn't hide a takeover of the lock
+func TestSQLiteLockRenewalRolledBack(t *testing.T) {
+	defer func(ttl, interval time.Duration) {
+		sqliteLockTTL, sqliteHeartbeatInterval = ttl, interval
+	}(sqliteLockTTL, sqliteHeartbeatInterval)
+	sqliteLockTTL, sqliteHeartbeatInterval = 50*time.Millisecond, time.Hour
+
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		tableName := makeTestMigrator(WithDialect(SQLite)).QuotedTableName()
+		holder, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = holder.Close() }()
+		err = SQLite.Lock(ctx, holder, tableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Renew the lock inside a transaction on the locked connection, as the
+		// heartbeat does during TransactionModeAllInOne, and roll it back
+		tx, err := holder.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renewed, err := newLeaseTable(SQLite, DefaultLockTableName).renew(ctx, tx, tableName, lockHolder(t, db, tableName), time.Hour)
+		if err != nil || !renewed {
+			t.Fatalf("Expected the lock to be renewed. Got %v", err)
+		}
+		err = tx.Rollback()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(2 * sqliteLockTTL)
+		err = SQLite.LockWithTimeout(ctx, db, tableName, 0)
+		if err != nil {
+			t.Fatalf("Expected the rolled back renewal to let the lock be taken over. Got %v", err)
+		}
+		err = SQLite.Unlock(ctx, holder, tableName)
+		if !errors.Is(err, ErrLockLost) {
+			t.Errorf("Expected ErrLockLost. Got %v", err)
+		}
+		_ = SQLite.Unlock(ctx, db, tableName)
+	})
+}
+
+// lockHolder returns the holder ID of the SQLite lock row for tableName
+func lockHolder(t *testing.T, db *sql.DB, tableName string) string {
+	t.Helper()
+	var holderID string
+	err := db.QueryRow(fmt.Sprintf(
+		`SELECT holder_id FROM %s WHERE lock_name = ?`,
+		SQLite.QuotedTableName("", DefaultLockTableName),
+	), tableName).Scan(&holderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return holderID
+}
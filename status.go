@@ -0,0 +1,107 @@
+package schema
+
+import "sort"
+
+// MigrationState describes where a single migration stands relative to the
+// tracking table.
+type MigrationState int
+
+const (
+	// StatePending indicates a supplied migration which has not been applied
+	StatePending MigrationState = iota
+
+	// StateApplied indicates a supplied migration which has been applied and
+	// whose Script is unchanged since
+	StateApplied
+
+	// StateChecksumMismatch indicates a supplied migration which has been
+	// applied, but whose Script has changed since
+	StateChecksumMismatch
+
+	// StateUnknown indicates a migration which has been applied, but was not
+	// among the supplied Migrations
+	StateUnknown
+)
+
+// String returns a human-readable name for the state
+func (s MigrationState) String() string {
+	switch s {
+	case StatePending:
+		return "pending"
+	case StateApplied:
+		return "applied"
+	case StateChecksumMismatch:
+		return "checksum mismatch"
+	case StateUnknown:
+		return "unknown"
+	default:
+		return "invalid"
+	}
+}
+
+// MigrationStatus is a single row of the report produced by Status.
+type MigrationStatus struct {
+	ID    string
+	State MigrationState
+
+	// Migration is the supplied Migration with this ID. It is nil when the
+	// State is StateUnknown.
+	Migration *Migration
+
+	// Applied is the tracking table's record of this migration, including
+	// its AppliedAt, ExecutionTimeInMillis and Checksum. It is nil when the
+	// State is StatePending.
+	Applied *AppliedMigration
+}
+
+// Status reports where every migration stands by joining the supplied
+// Migrations with the contents of the tracking table. The result contains
+// one MigrationStatus per ID, in order by ID.
+func (m *Migrator) Status(db DB, migrations []*Migration) (statuses []*MigrationStatus, err error) {
+	statuses = make([]*MigrationStatus, 0)
+	if db == nil {
+		return statuses, ErrNilDB
+	}
+
+	err = m.inLockedTx(db, func(tx Queryer) error {
+		applied, err := m.GetAppliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		statuses = m.status(applied, migrations)
+		return nil
+	})
+	return statuses, err
+}
+
+// status joins the already-applied migrations with the supplied ones
+func (m *Migrator) status(applied map[string]*AppliedMigration, migrations []*Migration) []*MigrationStatus {
+	statuses := make([]*MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := &MigrationStatus{ID: migration.ID, Migration: migration}
+		am, exists := applied[migration.ID]
+		switch {
+		case !exists:
+			status.State = StatePending
+		case m.checksumMatches(migration, am):
+			status.State = StateApplied
+		default:
+			status.State = StateChecksumMismatch
+		}
+		status.Applied = am
+		statuses = append(statuses, status)
+	}
+
+	for _, id := range unknownAppliedIDs(applied, migrations) {
+		statuses = append(statuses, &MigrationStatus{
+			ID:      id,
+			State:   StateUnknown,
+			Applied: applied[id],
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses
+}
@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		migrations := testMigrations(t, "useless-ansi")
+		err := migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		edited := &Migration{ID: migrations[1].ID, Script: migrations[1].Script + "\n-- edited"}
+		pending := &Migration{ID: "9999-99-99 Pending", Script: "SELECT 1"}
+		statuses, err := migrator.Status(db, []*Migration{pending, edited})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []struct {
+			id    string
+			state MigrationState
+		}{
+			{migrations[0].ID, StateUnknown},
+			{edited.ID, StateChecksumMismatch},
+			{pending.ID, StatePending},
+		}
+		if len(statuses) != len(expected) {
+			t.Fatalf("Expected %d statuses. Got %d", len(expected), len(statuses))
+		}
+		for i, e := range expected {
+			if statuses[i].ID != e.id || statuses[i].State != e.state {
+				t.Errorf("Expected status #%d to be '%s' %s. Got '%s' %s", i, e.id, e.state, statuses[i].ID, statuses[i].State)
+			}
+		}
+
+		unknown := statuses[0]
+		if unknown.Migration != nil {
+			t.Error("Expected unknown migration to have no Migration")
+		}
+		if unknown.Applied == nil || unknown.Applied.Checksum != migrations[0].MD5() || unknown.Applied.AppliedAt.IsZero() {
+			t.Errorf("Expected unknown migration to carry its tracking record. Got %+v", unknown.Applied)
+		}
+		if statuses[2].Applied != nil {
+			t.Error("Expected pending migration to have no Applied record")
+		}
+	})
+}
+
+func TestStatusOfAppliedMigration(t *testing.T) {
+	migrator := NewMigrator()
+	migration := &Migration{ID: "2021-01-01 001", Script: "SELECT 1"}
+	applied := map[string]*AppliedMigration{
+		migration.ID: {
+			Migration:             Migration{ID: migration.ID},
+			Checksum:              migration.MD5(),
+			ExecutionTimeInMillis: 4,
+			AppliedAt:             time.Now(),
+		},
+	}
+	statuses := migrator.status(applied, []*Migration{migration})
+	if len(statuses) != 1 {
+		t.Fatalf("Expected 1 status. Got %d", len(statuses))
+	}
+	if statuses[0].State != StateApplied {
+		t.Errorf("Expected %s. Got %s", StateApplied, statuses[0].State)
+	}
+	if statuses[0].Applied.ExecutionTimeInMillis != 4 {
+		t.Errorf("Expected the tracking record to be attached. Got %+v", statuses[0].Applied)
+	}
+}
+
+func TestStatusWithNilDB(t *testing.T) {
+	migrator := NewMigrator()
+	_, err := migrator.Status(nil, testMigrations(t, "useless-ansi"))
+	if !errors.Is(err, ErrNilDB) {
+		t.Errorf("Expected %v, got %v", ErrNilDB, err)
+	}
+}
+
+func TestMigrationStateString(t *testing.T) {
+	table := map[MigrationState]string{
+		StatePending:          "pending",
+		StateApplied:          "applied",
+		StateChecksumMismatch: "checksum mismatch",
+		StateUnknown:          "unknown",
+		MigrationState(99):    "invalid",
+	}
+	for state, expected := range table {
+		if state.String() != expected {
+			t.Errorf("Expected '%s'. Got '%s'", expected, state.String())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// TrackingTableVersion is the version of the tracking table's structure
+// which this package maintains. Tracking tables are created at version 1 by
+// CreateMigrationsTable, and upgraded one version at a time by Dialects which
+// implement MigrationsTableUpgrader. The versions are:
+//
+//  1. id, checksum, execution_time_in_millis and applied_at
+//  2. widens checksum to 255 characters (see ChecksumAlgorithm)
+//
+// Rows recorded by Baseline and Import, whose Scripts were never run, have
+// an execution_time_in_millis of -1. Queries which aggregate execution times
+// should exclude them.
+//
+// Tracking tables are only upgraded when the Migrator's options need it. The
+// optional columns added by WithExtendedTracking aren't versioned: they are
+// added by ExtendedTracker.ExtendMigrationsTable whenever it is enabled.
+const TrackingTableVersion = 2
+
+// wideChecksumVersion is the tracking table version whose checksum column
+// fits checksums other than MD5's
+const wideChecksumVersion = 2
+
+// trackingTableMetaSuffix is appended to the name of the tracking table to
+// name the table which records its version
+const trackingTableMetaSuffix = "_meta"
+
+// MigrationsTableUpgrader defines an optional Dialect extension for bringing
+// tracking tables created by older versions of this package up to date.
+// When the Migrator's options need a newer structure, the Migrator calls
+// UpgradeMigrationsTable once for each version between the one recorded in
+// the <TableName>_meta table and TrackingTableVersion, while holding the
+// lock, before planning migrations.
+type MigrationsTableUpgrader interface {
+	// UpgradeMigrationsTable alters the tracking table from the previous
+	// version of its structure to the supplied one
+	UpgradeMigrationsTable(ctx context.Context, tx Queryer, tableName string, version int) error
+}
+
+// QuotedMetaTableName returns the dialect-quoted fully-qualified name of the
+// table which records the version of the tracking table's structure
+func (m *Migrator) QuotedMetaTableName() string {
+	return m.Dialect.QuotedTableName(m.SchemaName, m.TableName+trackingTableMetaSuffix)
+}
+
+// requiredTrackingTableVersion returns the oldest version of the tracking
+// table's structure which supports the Migrator's options
+func (m Migrator) requiredTrackingTableVersion() int {
+	if m.checksumAlgorithm().Name() != MD5Checksum.Name() {
+		return wideChecksumVersion
+	}
+	return 1
+}
+
+// upgradeMigrationsTable brings the tracking table up to TrackingTableVersion
+// if the Dialect is a MigrationsTableUpgrader and the Migrator's options need
+// a newer structure, recording each new version in the meta table
+func (m Migrator) upgradeMigrationsTable(tx Queryer) error {
+	upgrader, upgradable := m.Dialect.(MigrationsTableUpgrader)
+	if !upgradable || m.requiredTrackingTableVersion() == 1 {
+		return nil
+	}
+
+	meta := metaTable{dialect: m.Dialect, name: m.QuotedMetaTableName()}
+	version, err := meta.version(m.ctx, tx)
+	if err != nil {
+		return err
+	}
+	if version > TrackingTableVersion {
+		m.log(fmt.Sprintf("WARNING: %s is at version %d, which is newer than the version this package maintains (%d)", m.QuotedTableName(), version, TrackingTableVersion))
+		return nil
+	}
+
+	for version < TrackingTableVersion {
+		version++
+		err = upgrader.UpgradeMigrationsTable(m.ctx, tx, m.QuotedTableName(), version)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade %s to version %d: %w", m.QuotedTableName(), version, err)
+		}
+		err = meta.setVersion(m.ctx, tx, version)
+		if err != nil {
+			return err
+		}
+		m.log(fmt.Sprintf("Upgraded %s to version %d", m.QuotedTableName(), version))
+	}
+	return nil
+}
+
+// metaTable runs the queries against the table which records the version of
+// a tracking table's structure. It holds a single row.
+type metaTable struct {
+	dialect Dialect
+	name    string
+}
+
+// version returns the recorded version, creating the meta table if
+// necessary. Tracking tables without a recorded version are at version 1.
+func (t metaTable) version(ctx context.Context, tx Queryer) (int, error) {
+	err := createTableIfNotExists(ctx, tx, t.dialect, t.name, `(version INTEGER NOT NULL)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	err = queryScalar(ctx, tx, &version, fmt.Sprintf(`SELECT MAX(version) FROM %s`, t.name))
+	if err != nil {
+		return 0, err
+	}
+	return max(int(version.Int64), 1), nil
+}
+
+// setVersion replaces the recorded version
+func (t metaTable) setVersion(ctx context.Context, tx Queryer, version int) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s`, t.name))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, bindPlaceholders(t.dialect, fmt.Sprintf(`INSERT INTO %s (version) VALUES (?)`, t.name)), version)
+	return err
+}
@@ -0,0 +1,170 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestUpgradeMigrationsTable ensures that a tracking table created by an
+// older version of this package is upgraded before migrations are planned
+func TestUpgradeMigrationsTable(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		ctx := context.Background()
+		var lines LogLines
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithChecksumAlgorithm(SHA256Checksum), WithLogger(&lines))
+		migrations := testMigrations(t, "useless-ansi")
+
+		// Simulate a version 1 tracking table, without a meta table
+		err := tdb.Dialect.CreateMigrationsTable(ctx, db, migrator.QuotedTableName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tdb.Dialect.InsertAppliedMigration(ctx, db, migrator.QuotedTableName(), &AppliedMigration{
+			Migration: *migrations[0],
+			AppliedAt: time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("Upgraded %s to version %d", migrator.QuotedTableName(), TrackingTableVersion)
+		if !lines.Contains(expected) {
+			t.Errorf("Expected '%s' to be logged. Got %v", expected, lines)
+		}
+		version, err := metaTable{dialect: tdb.Dialect, name: migrator.QuotedMetaTableName()}.version(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != TrackingTableVersion {
+			t.Errorf("Expected version %d to be recorded. Got %d", TrackingTableVersion, version)
+		}
+
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != len(migrations) {
+			t.Errorf("Expected %d applied migrations. Got %d", len(migrations), len(applied))
+		}
+
+		lines = nil
+		err = migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines.Contains("Upgraded") {
+			t.Errorf("Expected an up-to-date tracking table to be left alone. Got %v", lines)
+		}
+	})
+}
+
+// TestUpgradeMigrationsTableOnlyWhenNeeded ensures that an old tracking table
+// is left alone by a Migrator whose options don't need a newer structure, and
+// that the extended columns are only added when WithExtendedTracking is
+// enabled
+func TestUpgradeMigrationsTableOnlyWhenNeeded(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		var lines LogLines
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithLogger(&lines))
+		migrations := testMigrations(t, "useless-ansi")
+		hasExtendedColumns := func() bool {
+			_, err := db.Exec(fmt.Sprintf(`SELECT applied_by FROM %s`, migrator.QuotedTableName()))
+			return err == nil
+		}
+		hasMetaTable := func() bool {
+			_, err := db.Exec(fmt.Sprintf(`SELECT version FROM %s`, migrator.QuotedMetaTableName()))
+			return err == nil
+		}
+
+		// Simulate a version 1 tracking table, without a meta table
+		err := tdb.Dialect.CreateMigrationsTable(context.Background(), db, migrator.QuotedTableName())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines.Contains("Upgraded") {
+			t.Errorf("Expected a default Migrator not to upgrade the tracking table. Got %v", lines)
+		}
+		if hasExtendedColumns() {
+			t.Error("Expected a default Migrator not to add the extended columns")
+		}
+		if hasMetaTable() {
+			t.Error("Expected a default Migrator not to create the meta table")
+		}
+
+		// Wider checksums need an upgrade, but not the extended columns
+		sha256Migrator := NewMigrator(WithDialect(tdb.Dialect), WithTableName(migrator.SchemaName, migrator.TableName), WithChecksumAlgorithm(SHA256Checksum))
+		err = sha256Migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasMetaTable() {
+			t.Error("Expected the upgrade to be recorded in the meta table")
+		}
+		if hasExtendedColumns() {
+			t.Error("Expected the extended columns to be added only by WithExtendedTracking")
+		}
+
+		// The extended columns are added even though the table is up to date,
+		// and without a version of their own
+		lines = nil
+		extendedMigrator := NewMigrator(WithDialect(tdb.Dialect), WithTableName(migrator.SchemaName, migrator.TableName), WithExtendedTracking(), WithLogger(&lines))
+		err = extendedMigrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasExtendedColumns() {
+			t.Error("Expected WithExtendedTracking to add the extended columns")
+		}
+		if lines.Contains("Upgraded") {
+			t.Errorf("Expected no upgrade to be logged. Got %v", lines)
+		}
+		version, err := metaTable{dialect: tdb.Dialect, name: migrator.QuotedMetaTableName()}.version(context.Background(), db)
+		if err != nil || version != TrackingTableVersion {
+			t.Errorf("Expected version %d to be recorded. Got %d (%v)", TrackingTableVersion, version, err)
+		}
+	})
+}
+
+func TestUpgradeMigrationsTableFromTheFuture(t *testing.T) {
+	withTestDB(t, "sqlite", func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		var lines LogLines
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect), WithChecksumAlgorithm(SHA256Checksum), WithLogger(&lines))
+		meta := metaTable{dialect: tdb.Dialect, name: migrator.QuotedMetaTableName()}
+		_, err := meta.version(context.Background(), db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = meta.setVersion(context.Background(), db, TrackingTableVersion+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = migrator.Apply(db, testMigrations(t, "useless-ansi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !lines.Contains("which is newer than the version this package maintains") {
+			t.Errorf("Expected a warning about the newer version. Got %v", lines)
+		}
+	})
+}
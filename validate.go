@@ -0,0 +1,165 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned (wrapped) by Validate when the Script of an
+// already-applied Migration no longer matches the checksum recorded in the
+// tracking table.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// UnknownMigrationsError is returned when the tracking table contains
+// applied migrations whose IDs are not among the supplied Migrations. This
+// usually means that a migration was deleted or renamed, or that an older
+// build is running against a newer database.
+type UnknownMigrationsError struct {
+	// IDs of the unknown applied migrations, in order
+	IDs []string
+}
+
+func (e *UnknownMigrationsError) Error() string {
+	return fmt.Sprintf("the tracking table contains %d applied migration(s) which were not supplied: %s", len(e.IDs), quotedList(e.IDs))
+}
+
+// OutOfOrderError is returned when a pending migration's ID sorts before the
+// ID of the newest already-applied migration.
+type OutOfOrderError struct {
+	// Migration is the pending migration which arrived late
+	Migration *Migration
+
+	// LatestAppliedID is the ID of the newest already-applied migration
+	LatestAppliedID string
+}
+
+func (e *OutOfOrderError) Error() string {
+	return fmt.Sprintf("migration '%s' is out of order: it sorts before '%s', which has already been applied", e.Migration.ID, e.LatestAppliedID)
+}
+
+// ChecksumMismatch describes an applied migration whose Script has been
+// changed since it was run.
+type ChecksumMismatch struct {
+	ID string
+
+	// Expected is the checksum which was recorded in the tracking table when
+	// the migration was applied.
+	Expected string
+
+	// Actual is the checksum of the supplied Migration's current Script.
+	Actual string
+}
+
+// ValidationReport describes the inconsistencies Validate found between the
+// supplied Migrations and the tracking table.
+type ValidationReport struct {
+	// ChecksumMismatches lists applied migrations whose Scripts have changed,
+	// in order by ID.
+	ChecksumMismatches []ChecksumMismatch
+
+	// UnknownApplied lists the IDs of applied migrations which were not
+	// among the supplied Migrations, in order.
+	UnknownApplied []string
+}
+
+// Valid returns true when no inconsistencies were found
+func (r *ValidationReport) Valid() bool {
+	return len(r.ChecksumMismatches) == 0 && len(r.UnknownApplied) == 0
+}
+
+// Err summarizes the report as an error, or returns nil if the report is
+// Valid. Unknown applied migrations are reported as an
+// *UnknownMigrationsError, which can be extracted with errors.As.
+func (r *ValidationReport) Err() error {
+	var errs []error
+	if len(r.ChecksumMismatches) > 0 {
+		ids := make([]string, 0, len(r.ChecksumMismatches))
+		for _, mismatch := range r.ChecksumMismatches {
+			ids = append(ids, mismatch.ID)
+		}
+		errs = append(errs, fmt.Errorf("%w: the Script of applied migration(s) %s changed after being applied", ErrChecksumMismatch, quotedList(ids)))
+	}
+	if len(r.UnknownApplied) > 0 {
+		errs = append(errs, &UnknownMigrationsError{IDs: r.UnknownApplied})
+	}
+	return errors.Join(errs...)
+}
+
+// Validate compares the supplied Migrations against the tracking table
+// without running any of them. The returned report lists every problem
+// found, regardless of the Policies configured for Apply. If the report is
+// not Valid, its Err() is also returned so callers can simply check the
+// error.
+func (m *Migrator) Validate(db DB, migrations []*Migration) (report *ValidationReport, err error) {
+	report = &ValidationReport{}
+	if db == nil {
+		return report, ErrNilDB
+	}
+
+	err = m.inLockedTx(db, func(tx Queryer) error {
+		applied, err := m.GetAppliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		report = m.validate(applied, migrations)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	return report, report.Err()
+}
+
+// validate builds a ValidationReport from the already-applied migrations
+// and the supplied ones.
+func (m *Migrator) validate(applied map[string]*AppliedMigration, migrations []*Migration) *ValidationReport {
+	report := &ValidationReport{}
+	for _, migration := range migrations {
+		am, exists := applied[migration.ID]
+		if !exists {
+			continue
+		}
+		if !m.checksumMatches(migration, am) {
+			report.ChecksumMismatches = append(report.ChecksumMismatches, ChecksumMismatch{
+				ID:       migration.ID,
+				Expected: am.Checksum,
+				Actual:   m.checksumLike(migration, am.Checksum),
+			})
+		}
+	}
+	sort.Slice(report.ChecksumMismatches, func(i, j int) bool {
+		return report.ChecksumMismatches[i].ID < report.ChecksumMismatches[j].ID
+	})
+	report.UnknownApplied = unknownAppliedIDs(applied, migrations)
+	return report
+}
+
+// unknownAppliedIDs returns the sorted IDs of applied migrations which are
+// not among the supplied migrations.
+func unknownAppliedIDs(applied map[string]*AppliedMigration, migrations []*Migration) []string {
+	supplied := make(map[string]bool, len(migrations))
+	for _, migration := range migrations {
+		supplied[migration.ID] = true
+	}
+
+	ids := make([]string, 0)
+	for id := range applied {
+		if !supplied[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// quotedList formats IDs for inclusion in error messages
+func quotedList(ids []string) string {
+	quoted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		quoted = append(quoted, fmt.Sprintf("'%s'", id))
+	}
+	return strings.Join(quoted, ", ")
+}
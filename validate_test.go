@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateDetectsChecksumDrift(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		migrator := makeTestMigrator(WithDialect(tdb.Dialect))
+		migrations := testMigrations(t, "useless-ansi")
+		err := migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := migrator.Validate(db, migrations)
+		if err != nil {
+			t.Errorf("Expected untouched migrations to validate. Got %s", err)
+		}
+		if !report.Valid() {
+			t.Errorf("Expected a valid report. Got %+v", report)
+		}
+
+		edited := &Migration{ID: migrations[0].ID, Script: migrations[0].Script + "\n-- edited"}
+		report, err = migrator.Validate(db, []*Migration{edited, migrations[1]})
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("Expected ErrChecksumMismatch. Got %v", err)
+		}
+		if len(report.ChecksumMismatches) != 1 {
+			t.Fatalf("Expected 1 checksum mismatch. Got %d", len(report.ChecksumMismatches))
+		}
+		mismatch := report.ChecksumMismatches[0]
+		if mismatch.ID != edited.ID {
+			t.Errorf("Expected mismatch for '%s'. Got '%s'", edited.ID, mismatch.ID)
+		}
+		if mismatch.Expected != migrations[0].MD5() || mismatch.Actual != edited.MD5() {
+			t.Errorf("Unexpected checksums in %+v", mismatch)
+		}
+	})
+}
+
+func TestValidateWithNilDB(t *testing.T) {
+	migrator := NewMigrator()
+	_, err := migrator.Validate(nil, testMigrations(t, "useless-ansi"))
+	if !errors.Is(err, ErrNilDB) {
+		t.Errorf("Expected %v, got %v", ErrNilDB, err)
+	}
+}
+
+func TestValidateIgnoresPendingMigrations(t *testing.T) {
+	migrator := NewMigrator()
+	applied := map[string]*AppliedMigration{}
+	report := migrator.validate(applied, unorderedMigrations())
+	if !report.Valid() {
+		t.Errorf("Expected pending migrations to be valid. Got %+v", report)
+	}
+	if report.Err() != nil {
+		t.Errorf("Expected nil Err() for a valid report. Got %s", report.Err())
+	}
+}
+
+func TestUnknownAppliedMigrations(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		tableName := makeTestMigrator().TableName
+		migrations := testMigrations(t, "useless-ansi")
+		err := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName)).Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		remaining := migrations[1:]
+
+		t.Run("Validate", func(t *testing.T) {
+			migrator := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName))
+			report, err := migrator.Validate(db, remaining)
+			var unknownErr *UnknownMigrationsError
+			if !errors.As(err, &unknownErr) {
+				t.Fatalf("Expected an *UnknownMigrationsError. Got %v", err)
+			}
+			if len(report.UnknownApplied) != 1 || report.UnknownApplied[0] != migrations[0].ID {
+				t.Errorf("Expected '%s' to be reported as unknown. Got %v", migrations[0].ID, report.UnknownApplied)
+			}
+		})
+
+		t.Run("Warn", func(t *testing.T) {
+			var lines LogLines
+			migrator := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName), WithLogger(&lines))
+			err := migrator.Apply(db, remaining)
+			if err != nil {
+				t.Errorf("Expected PolicyWarn to allow Apply. Got %s", err)
+			}
+			if !lines.Contains(migrations[0].ID) {
+				t.Errorf("Expected a warning naming '%s'. Got %v", migrations[0].ID, lines)
+			}
+		})
+
+		t.Run("Fail", func(t *testing.T) {
+			migrator := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName), WithUnknownAppliedPolicy(PolicyFail))
+			err := migrator.Apply(db, remaining)
+			var unknownErr *UnknownMigrationsError
+			if !errors.As(err, &unknownErr) {
+				t.Fatalf("Expected an *UnknownMigrationsError. Got %v", err)
+			}
+			if len(unknownErr.IDs) != 1 || unknownErr.IDs[0] != migrations[0].ID {
+				t.Errorf("Expected IDs to be [%s]. Got %v", migrations[0].ID, unknownErr.IDs)
+			}
+		})
+	})
+}
+
+func TestOutOfOrderMigrations(t *testing.T) {
+	withEachTestDB(t, func(t *testing.T, tdb *TestDB) {
+		db := tdb.Connect(t)
+		defer func() { _ = db.Close() }()
+
+		tableName := makeTestMigrator().TableName
+		migrations := testMigrations(t, "useless-ansi")
+		err := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName)).Apply(db, migrations[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run("Fail", func(t *testing.T) {
+			migrator := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName), WithOutOfOrderPolicy(PolicyFail))
+			err := migrator.Apply(db, migrations)
+			var outOfOrderErr *OutOfOrderError
+			if !errors.As(err, &outOfOrderErr) {
+				t.Fatalf("Expected an *OutOfOrderError. Got %v", err)
+			}
+			if outOfOrderErr.Migration.ID != migrations[0].ID || outOfOrderErr.LatestAppliedID != migrations[1].ID {
+				t.Errorf("Unexpected error details: %s", err)
+			}
+			expectErrorContains(t, err, migrations[0].ID)
+			expectErrorContains(t, err, migrations[1].ID)
+		})
+
+		t.Run("Warn", func(t *testing.T) {
+			var lines LogLines
+			migrator := NewMigrator(WithDialect(tdb.Dialect), WithTableName(tableName), WithOutOfOrderPolicy(PolicyWarn), WithLogger(&lines))
+			err := migrator.Apply(db, migrations)
+			if err != nil {
+				t.Errorf("Expected PolicyWarn to allow Apply. Got %s", err)
+			}
+			if !lines.Contains("out of order") {
+				t.Errorf("Expected an out of order warning. Got %v", lines)
+			}
+			applied, err := migrator.GetAppliedMigrations(db)
+			if err != nil {
+				t.Error(err)
+			}
+			if _, exists := applied[migrations[0].ID]; !exists {
+				t.Errorf("Expected late migration '%s' to be applied", migrations[0].ID)
+			}
+		})
+	})
+}